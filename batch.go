@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+)
+
+const (
+	// batchSize 每次批量请求的最大 key 数, S3 DeleteObjects 与七牛 batch 都限制为 1000
+	batchSize = 1000
+	// batchConcurrency 没有批量接口时同时发出的请求数
+	batchConcurrency = 8
+)
+
+// BatchResult 批量操作中单个 key 的结果, Info 只在 StatMany 成功时有值
+type BatchResult struct {
+	Key  string
+	Info os.FileInfo
+	Err  error
+}
+
+// Batcher 支持批量删除与批量获取元数据的存储
+//
+// 返回的结果与 keys 一一对应, 单个 key 的错误保存在 BatchResult.Err 中;
+// 返回的 error 表示整个请求失败, 这时结果可能不完整. 与 Remove 相同,
+// 删除不存在的 key 不是错误
+type Batcher interface {
+	RemoveMany(ctx context.Context, keys []string) ([]BatchResult, error)
+	RemovePrefix(ctx context.Context, prefix string) ([]BatchResult, error)
+	StatMany(ctx context.Context, keys []string) ([]BatchResult, error)
+}
+
+// RemoveMany 批量删除, store 未实现 Batcher 时逐个删除
+func RemoveMany(ctx context.Context, store Storage, keys []string) ([]BatchResult, error) {
+	if batcher, ok := store.(Batcher); ok {
+		return batcher.RemoveMany(ctx, keys)
+	}
+
+	var sc = AdaptContext(store)
+	return batchEach(ctx, keys, func(ctx context.Context, key string) BatchResult {
+		return BatchResult{Key: key, Err: sc.RemoveContext(ctx, key)}
+	})
+}
+
+// RemovePrefix 删除 prefix 下的所有对象, store 未实现 Batcher 时列举后批量删除;
+// 为避免误删整个存储空间, prefix 不能为空
+func RemovePrefix(ctx context.Context, store Storage, prefix string) ([]BatchResult, error) {
+	if batcher, ok := store.(Batcher); ok {
+		return batcher.RemovePrefix(ctx, prefix)
+	}
+	return removePrefix(ctx, store, prefix)
+}
+
+// StatMany 批量获取元数据, store 未实现 Batcher 时并发调用 Stat
+func StatMany(ctx context.Context, store Storage, keys []string) ([]BatchResult, error) {
+	if batcher, ok := store.(Batcher); ok {
+		return batcher.StatMany(ctx, keys)
+	}
+	return statMany(ctx, AdaptContext(store), keys)
+}
+
+// removePrefix 按页列举 prefix 下的对象, 每页调用一次 RemoveMany
+func removePrefix(ctx context.Context, store Storage, prefix string) ([]BatchResult, error) {
+	if prefix == "" {
+		return nil, newError("remove", prefix, ErrInvalid, errors.New("empty prefix"))
+	}
+
+	var (
+		results []BatchResult
+		keys    = make([]string, 0, batchSize)
+	)
+
+	flush := func() error {
+		if len(keys) == 0 {
+			return nil
+		}
+		page, err := RemoveMany(ctx, store, keys)
+		results = append(results, page...)
+		keys = keys[:0]
+		return err
+	}
+
+	err := Walk(ctx, store, ListOptions{Prefix: prefix, Recursive: true}, func(info os.FileInfo) error {
+		keys = append(keys, info.Name())
+		if len(keys) < batchSize {
+			return nil
+		}
+		return flush()
+	})
+	if err != nil {
+		return results, err
+	}
+	return results, flush()
+}
+
+// statMany 没有批量接口时并发调用 StatContext
+func statMany(ctx context.Context, sc StorageContext, keys []string) ([]BatchResult, error) {
+	return batchEach(ctx, keys, func(ctx context.Context, key string) BatchResult {
+		info, err := sc.StatContext(ctx, key)
+		return BatchResult{Key: key, Info: info, Err: err}
+	})
+}
+
+// batchEach 以 batchConcurrency 的并发数对每个 key 调用 fn, ctx 取消时返回 ctx 的错误
+func batchEach(ctx context.Context, keys []string, fn func(ctx context.Context, key string) BatchResult) ([]BatchResult, error) {
+	var (
+		results = make([]BatchResult, len(keys))
+		sem     = make(chan struct{}, batchConcurrency)
+		wg      sync.WaitGroup
+	)
+
+	for i, key := range keys {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(i int, key string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			results[i] = fn(ctx, key)
+		}(i, key)
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// batchResults 按 keys 的顺序组装结果, errs 中没有的 key 视为成功
+func batchResults(keys []string, errs map[string]error) []BatchResult {
+	var results = make([]BatchResult, len(keys))
+	for i, key := range keys {
+		results[i] = BatchResult{Key: key, Err: errs[key]}
+	}
+	return results
+}
+
+// batchChunks 将 keys 按 batchSize 分组
+func batchChunks(keys []string) [][]string {
+	var chunks [][]string
+	for len(keys) > batchSize {
+		chunks = append(chunks, keys[:batchSize])
+		keys = keys[batchSize:]
+	}
+	if len(keys) > 0 {
+		chunks = append(chunks, keys)
+	}
+	return chunks
+}
@@ -0,0 +1,165 @@
+package storage
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemoveMany(t *testing.T) {
+	for name, store := range rangeStores(t) {
+		t.Run(name, func(t *testing.T) {
+			assert.NoError(t, store.Put("a.txt", []byte("a")))
+			assert.NoError(t, store.Put("b.txt", []byte("b")))
+
+			results, err := RemoveMany(context.Background(), store, []string{"a.txt", "missing.txt", "b.txt"})
+			assert.NoError(t, err)
+			assert.Len(t, results, 3)
+			for i, key := range []string{"a.txt", "missing.txt", "b.txt"} {
+				assert.Equal(t, key, results[i].Key)
+				assert.NoError(t, results[i].Err)
+			}
+			assert.False(t, store.Exist("a.txt"))
+			assert.False(t, store.Exist("b.txt"))
+		})
+	}
+}
+
+func TestRemovePrefix(t *testing.T) {
+	for name, store := range rangeStores(t) {
+		t.Run(name, func(t *testing.T) {
+			for _, key := range []string{"logs/a.log", "logs/2020/b.log", "logs.txt", "other/c.log"} {
+				assert.NoError(t, store.Put(key, []byte(key)))
+			}
+
+			results, err := RemovePrefix(context.Background(), store, "logs/")
+			assert.NoError(t, err)
+
+			var keys []string
+			for _, result := range results {
+				assert.NoError(t, result.Err)
+				keys = append(keys, result.Key)
+			}
+			sort.Strings(keys)
+			assert.Equal(t, []string{"logs/2020/b.log", "logs/a.log"}, keys)
+			assert.True(t, store.Exist("logs.txt"))
+			assert.True(t, store.Exist("other/c.log"))
+
+			_, err = RemovePrefix(context.Background(), store, "")
+			assert.True(t, errors.Is(err, ErrInvalid))
+		})
+	}
+}
+
+func TestStatMany(t *testing.T) {
+	store, err := NewMemory("batch", MemoryRegistry(NewRegistry()))
+	assert.NoError(t, err)
+
+	var keys []string
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("%02d.txt", i)
+		keys = append(keys, key)
+		assert.NoError(t, store.Put(key, []byte(key)))
+	}
+	keys = append(keys, "missing.txt")
+
+	results, err := StatMany(context.Background(), store, keys)
+	assert.NoError(t, err)
+	assert.Len(t, results, 21)
+	for i, result := range results[:20] {
+		assert.NoError(t, result.Err)
+		assert.Equal(t, keys[i], result.Key)
+		assert.Equal(t, int64(6), result.Info.Size())
+	}
+	assert.True(t, errors.Is(results[20].Err, ErrNotExist))
+	assert.Nil(t, results[20].Info)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = StatMany(ctx, store, keys)
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestBatchChunks(t *testing.T) {
+	var keys = make([]string, batchSize*2+1)
+	chunks := batchChunks(keys)
+	assert.Len(t, chunks, 3)
+	assert.Len(t, chunks[0], batchSize)
+	assert.Len(t, chunks[2], 1)
+	assert.Empty(t, batchChunks(nil))
+}
+
+// s3DeleteRequest DeleteObjects 的请求体
+type s3DeleteRequest struct {
+	Objects []struct {
+		Key string
+	} `xml:"Object"`
+}
+
+func TestS3ObjectStorage_RemoveMany(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests []int
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.URL.Query()["delete"]; !ok || r.Method != http.MethodPost {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+
+		b, _ := ioutil.ReadAll(r.Body)
+		var req s3DeleteRequest
+		if err := xml.Unmarshal(b, &req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		requests = append(requests, len(req.Objects))
+		mu.Unlock()
+
+		fmt.Fprint(w, `<DeleteResult>`)
+		for _, obj := range req.Objects {
+			if obj.Key == "locked.txt" {
+				fmt.Fprintf(w, `<Error><Key>%s</Key><Code>AccessDenied</Code><Message>Access Denied</Message></Error>`, obj.Key)
+			}
+		}
+		fmt.Fprint(w, `</DeleteResult>`)
+	}))
+	defer srv.Close()
+
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:           aws.String("us-east-1"),
+		Endpoint:         aws.String(srv.URL),
+		S3ForcePathStyle: aws.Bool(true),
+		Credentials:      credentials.NewStaticCredentials("key", "secret", ""),
+	}))
+	store, err := NewS3("key", "secret", "batch-s3", sess, S3Registry(NewRegistry()))
+	assert.NoError(t, err)
+
+	var keys []string
+	for i := 0; i < batchSize+10; i++ {
+		keys = append(keys, fmt.Sprintf("%04d.txt", i))
+	}
+	keys[5] = "locked.txt"
+
+	results, err := store.RemoveMany(context.Background(), keys)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{batchSize, 10}, requests)
+	assert.Len(t, results, len(keys))
+	assert.True(t, errors.Is(results[5].Err, ErrPermission))
+	assert.NoError(t, results[6].Err)
+}
@@ -0,0 +1,456 @@
+package storage
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// cachedMemorySize 内存缓存的默认容量
+	cachedMemorySize = 64 << 20
+	// cachedTTL 默认的缓存有效期, 过期后通过 Stat 重新验证
+	cachedTTL = time.Minute
+)
+
+type CachedOptionFunc func(*CachedStorage) error
+
+// CachedMemory 内存缓存的容量, 单位为字节, 0 表示不使用内存缓存
+func CachedMemory(maxBytes int64) CachedOptionFunc {
+	return func(store *CachedStorage) error {
+		store.memory = newCacheLRU(maxBytes, nil)
+		return nil
+	}
+}
+
+// CachedDisk 使用磁盘缓存, 在 dir 下创建临时目录保存缓存文件, Close 时删除
+func CachedDisk(dir string, maxBytes int64) CachedOptionFunc {
+	return func(store *CachedStorage) error {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return newError("cache", "", nil, err)
+		}
+
+		tmp, err := ioutil.TempDir(dir, "storage-cache-")
+		if err != nil {
+			return newError("cache", "", nil, err)
+		}
+
+		store.dir = tmp
+		store.disk = newCacheLRU(maxBytes, func(entry *cacheEntry) {
+			os.Remove(entry.file)
+		})
+		return nil
+	}
+}
+
+// CachedTTL 缓存的有效期, 有效期内直接使用缓存, 过期后对比 ETag 或修改时间与大小,
+// 对象没有变化时继续使用缓存; 0 表示每次读取都重新验证
+func CachedTTL(ttl time.Duration) CachedOptionFunc {
+	return func(store *CachedStorage) error {
+		if ttl < 0 {
+			return newError("cache", "", ErrInvalid, errors.New("negative ttl"))
+		}
+		store.ttl = ttl
+		return nil
+	}
+}
+
+// CachedStorage 读穿透缓存的存储
+//
+// Get 与 Open 依次查找内存与磁盘缓存, 都未命中时从底层存储读取并写入缓存,
+// 同一个 key 的并发读取只请求一次; 超过缓存容量的对象不缓存, Open 直接返回
+// 底层存储的读取流. 通过 CachedStorage 的写入、移动与删除
+// 会使缓存失效, 直接修改底层存储时依靠有效期与重新验证
+type CachedStorage struct {
+	Storage
+
+	ttl   time.Duration
+	dir   string
+	group singleflight.Group
+
+	mu     sync.Mutex
+	memory *cacheLRU
+	disk   *cacheLRU
+	// gen 每次失效时递增, 读取期间发生失效时不写入缓存
+	gen uint64
+}
+
+// NewCached 包装 store, 默认使用 64MiB 内存缓存, 有效期为 1 分钟
+func NewCached(store Storage, opts ...CachedOptionFunc) (*CachedStorage, error) {
+	if store == nil {
+		return nil, newError("cache", "", ErrInvalid, errors.New("nil storage"))
+	}
+
+	var cached = &CachedStorage{
+		Storage: store,
+		ttl:     cachedTTL,
+		memory:  newCacheLRU(cachedMemorySize, nil),
+		disk:    newCacheLRU(0, nil),
+	}
+
+	for _, opt := range opts {
+		if err := opt(cached); err != nil {
+			cached.Close()
+			return nil, err
+		}
+	}
+	return cached, nil
+}
+
+// cacheEntry 缓存的对象, 内存缓存保存 data, 磁盘缓存保存 file
+type cacheEntry struct {
+	key     string
+	size    int64
+	etag    string
+	modTime time.Time
+	expires time.Time
+	data    []byte
+	file    string
+}
+
+// valid 对象是否没有变化, 优先对比 ETag
+func (entry *cacheEntry) valid(info os.FileInfo) bool {
+	if meta := MetaOf(info); meta != nil && meta.ETag != "" && entry.etag != "" {
+		return meta.ETag == entry.etag
+	}
+	return info.Size() == entry.size && info.ModTime().Equal(entry.modTime)
+}
+
+// cacheLRU 按字节数限制容量的 LRU, 不是并发安全的
+type cacheLRU struct {
+	max     int64
+	size    int64
+	ll      *list.List
+	items   map[string]*list.Element
+	onEvict func(*cacheEntry)
+}
+
+func newCacheLRU(max int64, onEvict func(*cacheEntry)) *cacheLRU {
+	return &cacheLRU{max: max, ll: list.New(), items: make(map[string]*list.Element), onEvict: onEvict}
+}
+
+func (lru *cacheLRU) get(key string) *cacheEntry {
+	el, ok := lru.items[key]
+	if !ok {
+		return nil
+	}
+
+	lru.ll.MoveToFront(el)
+	return el.Value.(*cacheEntry)
+}
+
+// add 加入缓存并淘汰最久未使用的对象, 超过容量的对象不缓存
+func (lru *cacheLRU) add(entry *cacheEntry) bool {
+	lru.remove(entry.key)
+	if entry.size > lru.max {
+		return false
+	}
+
+	lru.items[entry.key] = lru.ll.PushFront(entry)
+	lru.size += entry.size
+	for lru.size > lru.max {
+		lru.evict(lru.ll.Back())
+	}
+	return true
+}
+
+func (lru *cacheLRU) remove(key string) {
+	if el, ok := lru.items[key]; ok {
+		lru.evict(el)
+	}
+}
+
+func (lru *cacheLRU) evict(el *list.Element) {
+	entry := lru.ll.Remove(el).(*cacheEntry)
+	delete(lru.items, entry.key)
+	lru.size -= entry.size
+	if lru.onEvict != nil {
+		lru.onEvict(entry)
+	}
+}
+
+func (lru *cacheLRU) purge() {
+	for lru.ll.Len() > 0 {
+		lru.evict(lru.ll.Back())
+	}
+}
+
+// lookup 查找缓存, 磁盘缓存命中时提升到内存缓存; 返回的 entry 是副本
+func (store *CachedStorage) lookup(key string) (*cacheEntry, []byte) {
+	store.mu.Lock()
+	if entry := store.memory.get(key); entry != nil {
+		var hit = *entry
+		store.mu.Unlock()
+		return &hit, entry.data
+	}
+
+	entry := store.disk.get(key)
+	if entry == nil {
+		store.mu.Unlock()
+		return nil, nil
+	}
+	var hit = *entry
+	store.mu.Unlock()
+
+	// 文件可能已经被淘汰, 视为未命中
+	data, err := ioutil.ReadFile(hit.file)
+	if err != nil || int64(len(data)) != hit.size {
+		return nil, nil
+	}
+
+	store.mu.Lock()
+	if store.disk.get(key) == entry {
+		promoted := hit
+		promoted.data, promoted.file = data, ""
+		store.memory.add(&promoted)
+	}
+	store.mu.Unlock()
+	return &hit, data
+}
+
+// fill 写入缓存, gen 与当前不一致时说明读取期间对象被修改, 不写入
+func (store *CachedStorage) fill(gen uint64, entry *cacheEntry, data []byte) {
+	var file string
+	if store.dir != "" && entry.size <= store.disk.max {
+		if f, err := ioutil.TempFile(store.dir, "object-"); err == nil {
+			_, err = f.Write(data)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err == nil {
+				file = f.Name()
+			} else {
+				os.Remove(f.Name())
+			}
+		}
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if gen != store.gen {
+		if file != "" {
+			os.Remove(file)
+		}
+		return
+	}
+
+	memory := *entry
+	memory.data = data
+	store.memory.add(&memory)
+
+	if file != "" {
+		disk := *entry
+		disk.file = file
+		if !store.disk.add(&disk) {
+			os.Remove(file)
+		}
+	}
+}
+
+// refresh 重新验证通过后延长有效期
+func (store *CachedStorage) refresh(key string, expires time.Time) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for _, lru := range []*cacheLRU{store.memory, store.disk} {
+		if entry := lru.get(key); entry != nil {
+			entry.expires = expires
+		}
+	}
+}
+
+// errUncacheable 对象超过内存与磁盘缓存的容量
+var errUncacheable = errors.New("storage: object too large to cache")
+
+// cacheKey 与后端一致, 忽略开头的 /
+func cacheKey(key string) string {
+	return strings.TrimPrefix(key, "/")
+}
+
+// cacheable 对象是否可以放入内存或磁盘缓存
+func (store *CachedStorage) cacheable(size int64) bool {
+	return size <= store.memory.max || store.dir != "" && size <= store.disk.max
+}
+
+// load 重新验证或读取对象, 由 singleflight 合并同一个 key 的并发调用
+func (store *CachedStorage) load(key string) ([]byte, error) {
+	store.mu.Lock()
+	gen := store.gen
+	store.mu.Unlock()
+
+	info, err := store.Storage.Stat(key)
+	if err != nil {
+		if errors.Is(err, ErrNotExist) {
+			store.Invalidate(key)
+		}
+		return nil, err
+	}
+
+	// 超过缓存容量的对象不读取, 由调用者直接使用底层存储
+	if !store.cacheable(info.Size()) {
+		store.Invalidate(key)
+		return nil, errUncacheable
+	}
+
+	var expires = time.Now().Add(store.ttl)
+	if entry, data := store.lookup(key); entry != nil && entry.valid(info) {
+		store.refresh(key, expires)
+		return data, nil
+	}
+
+	data, err := store.Storage.Get(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var entry = &cacheEntry{
+		key:     key,
+		size:    int64(len(data)),
+		modTime: info.ModTime(),
+		expires: expires,
+	}
+	if meta := MetaOf(info); meta != nil {
+		entry.etag = meta.ETag
+	}
+	// Stat 之后对象被修改时大小不一致, 不记录修改时间, 下次重新验证时重新读取
+	if entry.size != info.Size() {
+		entry.etag, entry.modTime = "", time.Time{}
+	}
+
+	store.fill(gen, entry, data)
+	return data, nil
+}
+
+// Get 读取对象, 有效期内直接返回缓存
+func (store *CachedStorage) Get(key string) ([]byte, error) {
+	key = cacheKey(key)
+	data, err := store.get(key)
+	if err == errUncacheable {
+		return store.Storage.Get(key)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 缓存与并发的调用共享同一份数据, 返回副本
+	return append([]byte(nil), data...), nil
+}
+
+// get 返回缓存中共享的数据, 不能修改
+func (store *CachedStorage) get(key string) ([]byte, error) {
+	if entry, data := store.lookup(key); entry != nil && time.Now().Before(entry.expires) {
+		return data, nil
+	}
+
+	v, err, _ := store.group.Do(key, func() (interface{}, error) {
+		return store.load(key)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]byte), nil
+}
+
+// Open 读取缓存的对象, 超过缓存容量的对象直接返回底层存储的读取流
+func (store *CachedStorage) Open(key string) (io.ReadCloser, error) {
+	key = cacheKey(key)
+	data, err := store.get(key)
+	if err == errUncacheable {
+		return store.Storage.Open(key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+// Invalidate 删除 key 的缓存
+func (store *CachedStorage) Invalidate(key string) {
+	key = cacheKey(key)
+
+	store.mu.Lock()
+	store.gen++
+	store.memory.remove(key)
+	store.disk.remove(key)
+	store.mu.Unlock()
+
+	store.group.Forget(key)
+}
+
+// Purge 清空所有缓存
+func (store *CachedStorage) Purge() {
+	store.mu.Lock()
+	store.gen++
+	store.memory.purge()
+	store.disk.purge()
+	store.mu.Unlock()
+}
+
+// Close 清空缓存并删除磁盘缓存的目录
+func (store *CachedStorage) Close() error {
+	store.Purge()
+	if store.dir == "" {
+		return nil
+	}
+	return os.RemoveAll(store.dir)
+}
+
+func (store *CachedStorage) PutFile(key string, file string) error {
+	defer store.Invalidate(key)
+	return store.Storage.PutFile(key, file)
+}
+
+func (store *CachedStorage) Put(key string, val []byte) error {
+	defer store.Invalidate(key)
+	return store.Storage.Put(key, val)
+}
+
+func (store *CachedStorage) PutReader(key string, r io.Reader, size int64) error {
+	defer store.Invalidate(key)
+	return store.Storage.PutReader(key, r, size)
+}
+
+func (store *CachedStorage) PutObject(key string, r io.Reader, size int64, opts PutOptions) error {
+	return store.PutObjectContext(context.Background(), key, r, size, opts)
+}
+
+func (store *CachedStorage) PutObjectContext(ctx context.Context, key string, r io.Reader, size int64, opts PutOptions) error {
+	defer store.Invalidate(key)
+	return PutObject(ctx, store.Storage, key, r, size, opts)
+}
+
+func (store *CachedStorage) Move(dest string, from string) error {
+	defer store.Invalidate(from)
+	defer store.Invalidate(dest)
+	return store.Storage.Move(dest, from)
+}
+
+func (store *CachedStorage) Remove(key string) error {
+	defer store.Invalidate(key)
+	return store.Storage.Remove(key)
+}
+
+func (store *CachedStorage) Copy(dest string, from string, opts ...CopyOptionFunc) error {
+	return store.CopyContext(context.Background(), dest, from, opts...)
+}
+
+func (store *CachedStorage) CopyContext(ctx context.Context, dest string, from string, opts ...CopyOptionFunc) error {
+	defer store.Invalidate(dest)
+	return Copy(ctx, store.Storage, dest, store.Storage, from, opts...)
+}
+
+var (
+	_ Storage = &CachedStorage{}
+	_ Putter  = &CachedStorage{}
+	_ Copier  = &CachedStorage{}
+)
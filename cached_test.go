@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countingStorage 记录 Get 的次数, release 不为空时 Get 等待 release 关闭
+type countingStorage struct {
+	Storage
+
+	gets    int32
+	release chan struct{}
+}
+
+func (store *countingStorage) Get(key string) ([]byte, error) {
+	atomic.AddInt32(&store.gets, 1)
+	if store.release != nil {
+		<-store.release
+	}
+	return store.Storage.Get(key)
+}
+
+func newCountingMemory(t *testing.T) *countingStorage {
+	inner, err := NewMemory("cached", MemoryRegistry(NewRegistry()))
+	assert.NoError(t, err)
+	return &countingStorage{Storage: inner}
+}
+
+func TestCachedStorage_Get(t *testing.T) {
+	inner := newCountingMemory(t)
+	store, err := NewCached(inner)
+	assert.NoError(t, err)
+	defer store.Close()
+
+	assert.NoError(t, inner.Put("thumb.jpg", []byte("v1")))
+	for i := 0; i < 3; i++ {
+		got, err := store.Get("thumb.jpg")
+		assert.NoError(t, err)
+		assert.Equal(t, "v1", string(got))
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&inner.gets))
+
+	// 通过 CachedStorage 写入时缓存失效
+	assert.NoError(t, store.Put("thumb.jpg", []byte("v2")))
+	got, err := store.Get("thumb.jpg")
+	assert.NoError(t, err)
+	assert.Equal(t, "v2", string(got))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&inner.gets))
+
+	assert.NoError(t, store.Move("moved.jpg", "thumb.jpg"))
+	_, err = store.Get("thumb.jpg")
+	assert.ErrorIs(t, err, ErrNotExist)
+
+	assert.NoError(t, store.Remove("moved.jpg"))
+	_, err = store.Get("moved.jpg")
+	assert.ErrorIs(t, err, ErrNotExist)
+}
+
+func TestCachedStorage_revalidate(t *testing.T) {
+	inner := newCountingMemory(t)
+	store, err := NewCached(inner, CachedTTL(0))
+	assert.NoError(t, err)
+	defer store.Close()
+
+	assert.NoError(t, inner.Put("a.txt", []byte("v1")))
+	for i := 0; i < 3; i++ {
+		_, err = store.Get("a.txt")
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&inner.gets))
+
+	// 直接修改底层存储, 重新验证时 ETag 不一致
+	assert.NoError(t, inner.Put("a.txt", []byte("v2")))
+	got, err := store.Get("a.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "v2", string(got))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&inner.gets))
+}
+
+func TestCachedStorage_singleflight(t *testing.T) {
+	inner := newCountingMemory(t)
+	inner.release = make(chan struct{})
+	store, err := NewCached(inner)
+	assert.NoError(t, err)
+	defer store.Close()
+
+	assert.NoError(t, inner.Storage.Put("a.txt", []byte("hello")))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := store.Get("a.txt")
+			assert.NoError(t, err)
+			assert.Equal(t, "hello", string(got))
+		}()
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	close(inner.release)
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&inner.gets))
+}
+
+func TestCachedStorage_disk(t *testing.T) {
+	inner := newCountingMemory(t)
+	store, err := NewCached(inner, CachedMemory(0), CachedDisk(t.TempDir(), 10))
+	assert.NoError(t, err)
+
+	assert.NoError(t, inner.Put("a", []byte("aaaaaa")))
+	assert.NoError(t, inner.Put("b", []byte("bbbbbb")))
+
+	for i := 0; i < 2; i++ {
+		got, err := store.Get("a")
+		assert.NoError(t, err)
+		assert.Equal(t, "aaaaaa", string(got))
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&inner.gets))
+
+	// 超过容量时淘汰 a
+	_, err = store.Get("b")
+	assert.NoError(t, err)
+	files, err := os.ReadDir(store.dir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+
+	_, err = store.Get("a")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&inner.gets))
+
+	assert.NoError(t, store.Close())
+	_, err = os.Stat(store.dir)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestCachedStorage_Open(t *testing.T) {
+	inner := newCountingMemory(t)
+	store, err := NewCached(inner, CachedMemory(4))
+	assert.NoError(t, err)
+	defer store.Close()
+
+	// 超过缓存容量的对象直接读取底层存储的流
+	assert.NoError(t, inner.Put("large.bin", []byte("0123456789")))
+	r, err := store.Open("large.bin")
+	assert.NoError(t, err)
+	got, err := ioutil.ReadAll(r)
+	assert.NoError(t, err)
+	assert.NoError(t, r.Close())
+	assert.Equal(t, "0123456789", string(got))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&inner.gets))
+
+	// 开头的 / 与后端一致
+	assert.NoError(t, inner.Put("a", []byte("v1")))
+	got, err = store.Get("/a")
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", string(got))
+
+	assert.NoError(t, inner.Put("a", []byte("v2")))
+	store.Invalidate("a")
+	got, err = store.Get("/a")
+	assert.NoError(t, err)
+	assert.Equal(t, "v2", string(got))
+}
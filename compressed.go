@@ -0,0 +1,390 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Codec 压缩算法, 取值与 Content-Encoding 相同
+type Codec string
+
+const (
+	CodecGzip Codec = "gzip"
+	CodecZstd Codec = "zstd"
+	// codecIdentity 未压缩, 用于标记跳过压缩的对象
+	codecIdentity Codec = "identity"
+)
+
+const (
+	// compressedMetaKey 在用户元数据中记录压缩算法
+	compressedMetaKey = "compression"
+	// compressedSpoolSize 压缩后的内容在内存中最多缓存的字节数, 超过后写入临时文件
+	compressedSpoolSize = 8 << 20
+)
+
+// compressedFrameMagic 不保存元数据的后端在压缩内容前写入的头部, 后面跟一个字节的算法
+var compressedFrameMagic = []byte("\x89HSZ\r\n\x1a")
+
+// compressedFrameCodecs 头部中的算法编号
+var compressedFrameCodecs = map[byte]Codec{'g': CodecGzip, 'z': CodecZstd}
+
+// metadataKeeper 保存 PutOptions 的 Metadata 并在 Stat 时返回的存储,
+// CompressedStorage 在这些存储上通过元数据记录压缩算法, 其它存储写入头部
+type metadataKeeper interface {
+	keepsMetadata()
+}
+
+// compressedTypes 本身已经压缩的内容, 不再压缩
+var compressedTypes = []string{
+	"image/",
+	"video/",
+	"audio/",
+	"application/zip",
+	"application/gzip",
+	"application/x-gzip",
+	"application/zstd",
+	"application/x-bzip2",
+	"application/x-xz",
+	"application/x-7z-compressed",
+	"application/x-rar-compressed",
+	"application/vnd.rar",
+}
+
+type CompressedOptionFunc func(*CompressedStorage) error
+
+// CompressedCodec 指定压缩算法, 默认为 gzip
+func CompressedCodec(codec Codec) CompressedOptionFunc {
+	return func(store *CompressedStorage) error {
+		switch codec {
+		case CodecGzip, CodecZstd:
+			store.codec = codec
+			return nil
+		default:
+			return newError("compress", "", ErrInvalid, fmt.Errorf("unknown codec %q", codec))
+		}
+	}
+}
+
+// CompressedSkip 增加不压缩的 Content-Type, 以 / 结尾时匹配整个类型, 例如 "font/"
+func CompressedSkip(types ...string) CompressedOptionFunc {
+	return func(store *CompressedStorage) error {
+		store.skip = append(store.skip, types...)
+		return nil
+	}
+}
+
+// CompressedStorage 透明压缩的存储
+//
+// 上传时使用 gzip 或 zstd 压缩, 并在用户元数据中记录压缩算法;
+// 不保存元数据的后端 (本地、FastDFS、七牛等) 在压缩内容前写入一个头部记录算法.
+// 读取时只解压记录了算法的对象, 其它对象原样返回. 图片、视频、压缩包等已经压缩的
+// 内容, 以及已经指定 ContentEncoding 的上传不再压缩. List 与 Stat 返回的是压缩后的大小
+type CompressedStorage struct {
+	Storage
+
+	codec  Codec
+	skip   []string
+	framed bool
+}
+
+// NewCompressed 包装 store, 上传时压缩, 读取时解压
+func NewCompressed(store Storage, opts ...CompressedOptionFunc) (*CompressedStorage, error) {
+	if store == nil {
+		return nil, newError("compress", "", ErrInvalid, errors.New("nil storage"))
+	}
+
+	var compressed = &CompressedStorage{
+		Storage: store,
+		codec:   CodecGzip,
+		skip:    append([]string(nil), compressedTypes...),
+	}
+	_, keeps := store.(metadataKeeper)
+	compressed.framed = !keeps
+
+	for _, opt := range opts {
+		if err := opt(compressed); err != nil {
+			return nil, err
+		}
+	}
+	return compressed, nil
+}
+
+// skipped 是否为不需要压缩的内容
+func (store *CompressedStorage) skipped(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = contentType
+	}
+
+	for _, typ := range store.skip {
+		if mediaType == typ || strings.HasSuffix(typ, "/") && strings.HasPrefix(mediaType, typ) {
+			return true
+		}
+	}
+	return false
+}
+
+func (store *CompressedStorage) encoder(w io.Writer) (io.WriteCloser, error) {
+	switch store.codec {
+	case CodecZstd:
+		return zstd.NewWriter(w)
+	default:
+		return gzip.NewWriter(w), nil
+	}
+}
+
+func (store *CompressedStorage) PutFile(key string, file string) error {
+	return putFile(context.Background(), store, key, file)
+}
+
+func (store *CompressedStorage) Put(key string, val []byte) error {
+	return store.PutReader(key, bytes.NewReader(val), int64(len(val)))
+}
+
+func (store *CompressedStorage) PutReader(key string, r io.Reader, size int64) error {
+	return store.PutObjectContext(context.Background(), key, r, size, PutOptions{})
+}
+
+func (store *CompressedStorage) PutObject(key string, r io.Reader, size int64, opts PutOptions) error {
+	return store.PutObjectContext(context.Background(), key, r, size, opts)
+}
+
+// PutObjectContext 压缩后按实际大小上传, 压缩后的内容先写入内存, 超过 8MiB 后
+// 写入临时文件, 避免底层存储按未知大小分片上传
+func (store *CompressedStorage) PutObjectContext(ctx context.Context, key string, r io.Reader, size int64, opts PutOptions) error {
+	r, err := opts.detect(key, r)
+	if err != nil {
+		return err
+	}
+
+	var metadata = make(map[string]string, len(opts.Metadata)+1)
+	for k, v := range opts.Metadata {
+		metadata[k] = v
+	}
+	opts.Metadata = metadata
+
+	if opts.ContentEncoding != "" || store.skipped(opts.ContentType) {
+		metadata[compressedMetaKey] = string(codecIdentity)
+		return PutObject(ctx, store.Storage, key, r, size, opts)
+	}
+
+	// 不设置 Content-Encoding, 否则 S3 下载时 net/http 会自动解压 gzip
+	metadata[compressedMetaKey] = string(store.codec)
+
+	var buf = &spoolBuffer{limit: compressedSpoolSize}
+	defer buf.Close()
+
+	if store.framed {
+		buf.Write(store.frame())
+	}
+
+	enc, err := store.encoder(buf)
+	if err != nil {
+		return newError("put", key, nil, err)
+	}
+	_, err = io.Copy(enc, r)
+	if cerr := enc.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return newError("put", key, nil, err)
+	}
+
+	body, err := buf.reader()
+	if err != nil {
+		return newError("put", key, nil, err)
+	}
+	return PutObject(ctx, store.Storage, key, body, buf.size, opts)
+}
+
+// spoolBuffer 先写入内存, 超过 limit 后转存到临时文件
+type spoolBuffer struct {
+	limit int
+	size  int64
+	buf   bytes.Buffer
+	file  *os.File
+	err   error
+}
+
+func (b *spoolBuffer) Write(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+
+	if b.file == nil && b.buf.Len()+len(p) > b.limit {
+		if b.file, b.err = ioutil.TempFile("", "storage-compress-"); b.err != nil {
+			return 0, b.err
+		}
+		if _, b.err = b.buf.WriteTo(b.file); b.err != nil {
+			return 0, b.err
+		}
+	}
+
+	var n int
+	if b.file != nil {
+		n, b.err = b.file.Write(p)
+	} else {
+		n, _ = b.buf.Write(p)
+	}
+	b.size += int64(n)
+	return n, b.err
+}
+
+// reader 返回写入的全部内容, 可以 Seek, 便于后端按已知大小上传
+func (b *spoolBuffer) reader() (io.ReadSeeker, error) {
+	if b.file == nil {
+		return bytes.NewReader(b.buf.Bytes()), nil
+	}
+	if _, err := b.file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return b.file, nil
+}
+
+// Close 删除临时文件
+func (b *spoolBuffer) Close() error {
+	if b.file == nil {
+		return nil
+	}
+	b.file.Close()
+	return os.Remove(b.file.Name())
+}
+
+// frame 压缩内容前的头部
+func (store *CompressedStorage) frame() []byte {
+	for id, codec := range compressedFrameCodecs {
+		if codec == store.codec {
+			return append(append([]byte(nil), compressedFrameMagic...), id)
+		}
+	}
+	return nil
+}
+
+// codecOf 返回元数据中记录的压缩算法, 没有记录时为未压缩; 不使用 Content-Encoding,
+// 带 Content-Encoding: gzip 的对象下载时可能已经被 HTTP 客户端解压
+func codecOf(meta *ObjectMeta) Codec {
+	if meta == nil {
+		return codecIdentity
+	}
+
+	for k, v := range meta.Metadata {
+		if strings.EqualFold(k, compressedMetaKey) {
+			return Codec(v)
+		}
+	}
+	return codecIdentity
+}
+
+// frameCodecOf 返回头部中记录的压缩算法, 没有头部时为未压缩
+func frameCodecOf(head []byte) Codec {
+	if len(head) <= len(compressedFrameMagic) || !bytes.HasPrefix(head, compressedFrameMagic) {
+		return codecIdentity
+	}
+
+	if codec, ok := compressedFrameCodecs[head[len(compressedFrameMagic)]]; ok {
+		return codec
+	}
+	return codecIdentity
+}
+
+// decompressReader 关闭时同时关闭解压器与原始的读取流
+type decompressReader struct {
+	io.Reader
+	decoder io.Closer
+	body    io.Closer
+}
+
+func (r *decompressReader) Close() error {
+	if r.decoder != nil {
+		r.decoder.Close()
+	}
+	return r.body.Close()
+}
+
+// Open 打开解压后的读取流, 没有记录压缩算法的对象原样返回
+func (store *CompressedStorage) Open(key string) (io.ReadCloser, error) {
+	var codec Codec
+	if !store.framed {
+		info, err := store.Storage.Stat(key)
+		if err != nil {
+			return nil, err
+		}
+		codec = codecOf(MetaOf(info))
+	}
+
+	body, err := store.Storage.Open(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var br = bufio.NewReader(body)
+	if store.framed {
+		head, _ := br.Peek(len(compressedFrameMagic) + 1)
+		if codec = frameCodecOf(head); codec != codecIdentity {
+			br.Discard(len(head))
+		}
+	}
+
+	var r = &decompressReader{Reader: br, body: body}
+	switch codec {
+	case CodecGzip:
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			body.Close()
+			return nil, newError("get", key, ErrInvalid, err)
+		}
+		r.Reader, r.decoder = gz, gz
+	case CodecZstd:
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			body.Close()
+			return nil, newError("get", key, ErrInvalid, err)
+		}
+		r.Reader, r.decoder = zr, zr.IOReadCloser()
+	case codecIdentity, "":
+	default:
+		body.Close()
+		return nil, newError("get", key, ErrInvalid, fmt.Errorf("unknown codec %q", codec))
+	}
+	return r, nil
+}
+
+func (store *CompressedStorage) Get(key string) ([]byte, error) {
+	body, err := store.Open(key)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, newError("get", key, nil, err)
+	}
+	return b, nil
+}
+
+func (store *CompressedStorage) Copy(dest string, from string, opts ...CopyOptionFunc) error {
+	return store.CopyContext(context.Background(), dest, from, opts...)
+}
+
+// CopyContext 原样复制压缩后的内容与元数据
+func (store *CompressedStorage) CopyContext(ctx context.Context, dest string, from string, opts ...CopyOptionFunc) error {
+	return Copy(ctx, store.Storage, dest, store.Storage, from, opts...)
+}
+
+var (
+	_ Storage = &CompressedStorage{}
+	_ Putter  = &CompressedStorage{}
+	_ Copier  = &CompressedStorage{}
+)
@@ -0,0 +1,245 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompressedStorage_Put(t *testing.T) {
+	var logs = []byte(strings.Repeat(`{"level":"info","msg":"request"}`+"\n", 1000))
+
+	for _, codec := range []Codec{CodecGzip, CodecZstd} {
+		inner, err := NewMemory("compressed", MemoryRegistry(NewRegistry()))
+		assert.NoError(t, err)
+		store, err := NewCompressed(inner, CompressedCodec(codec))
+		assert.NoError(t, err)
+
+		assert.NoError(t, store.Put("app.log", logs))
+		got, err := store.Get("app.log")
+		assert.NoError(t, err)
+		assert.Equal(t, logs, got)
+
+		raw, err := inner.Get("app.log")
+		assert.NoError(t, err)
+		assert.Less(t, len(raw), len(logs)/10)
+
+		info, err := inner.Stat("app.log")
+		assert.NoError(t, err)
+		meta := MetaOf(info)
+		assert.Empty(t, meta.ContentEncoding)
+		assert.Equal(t, string(codec), meta.Metadata[compressedMetaKey])
+
+		// 已经压缩的内容原样保存
+		var png = append([]byte("\x89PNG\r\n\x1a\n"), logs...)
+		assert.NoError(t, store.Put("avatar.png", png))
+		raw, err = inner.Get("avatar.png")
+		assert.NoError(t, err)
+		assert.Equal(t, png, raw)
+		got, err = store.Get("avatar.png")
+		assert.NoError(t, err)
+		assert.Equal(t, png, got)
+	}
+
+	_, err := NewCompressed(nil)
+	assert.Error(t, err)
+	_, err = NewCompressed(&MemoryStorage{}, CompressedCodec("br"))
+	assert.Error(t, err)
+}
+
+func TestCompressedStorage_PutFile(t *testing.T) {
+	dir := t.TempDir()
+	inner, err := NewLocal(filepath.Join(dir, "root"), LocalRegistry(NewRegistry()))
+	assert.NoError(t, err)
+	store, err := NewCompressed(inner, CompressedCodec(CodecZstd))
+	assert.NoError(t, err)
+
+	var csv = []byte(strings.Repeat("id,name,amount\n1,alice,100\n", 500))
+	file := filepath.Join(dir, "export.csv")
+	assert.NoError(t, os.WriteFile(file, csv, 0644))
+
+	// 本地存储不保存元数据, 在压缩内容前写入头部
+	assert.NoError(t, store.PutFile("export.csv", file))
+	raw, err := inner.Get("export.csv")
+	assert.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(raw, append(append([]byte(nil), compressedFrameMagic...), 'z')))
+
+	got, err := store.Get("export.csv")
+	assert.NoError(t, err)
+	assert.Equal(t, csv, got)
+
+	// 未经压缩写入的对象原样读取
+	assert.NoError(t, inner.Put("plain.txt", []byte("hello")))
+	got, err = store.Get("plain.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(got))
+
+	// 跳过压缩的 gzip 文件不会被解压
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write([]byte("hello"))
+	w.Close()
+	assert.NoError(t, store.Put("backup.tar.gz", gz.Bytes()))
+	got, err = store.Get("backup.tar.gz")
+	assert.NoError(t, err)
+	assert.Equal(t, gz.Bytes(), got)
+}
+
+func TestCompressedStorage_skipped(t *testing.T) {
+	store, err := NewCompressed(&MemoryStorage{}, CompressedSkip("font/"))
+	assert.NoError(t, err)
+
+	for contentType, want := range map[string]bool{
+		"image/jpeg":                true,
+		"video/mp4":                 true,
+		"application/zip":           true,
+		"font/woff2":                true,
+		"application/json":          false,
+		"text/csv; charset=utf-8":   false,
+		"application/gzip; foo=bar": true,
+	} {
+		assert.Equal(t, want, store.skipped(contentType), contentType)
+	}
+}
+
+// sizeStorage 记录 PutReader 收到的大小
+type sizeStorage struct {
+	Storage
+
+	sizes []int64
+}
+
+func (store *sizeStorage) PutReader(key string, r io.Reader, size int64) error {
+	store.sizes = append(store.sizes, size)
+	return store.Storage.PutReader(key, r, size)
+}
+
+func TestCompressedStorage_size(t *testing.T) {
+	inner, err := NewMemory("compressed-size", MemoryRegistry(NewRegistry()))
+	assert.NoError(t, err)
+	sized := &sizeStorage{Storage: inner}
+	store, err := NewCompressed(sized)
+	assert.NoError(t, err)
+
+	// 按压缩后的实际大小上传
+	assert.NoError(t, store.Put("a.json", []byte(strings.Repeat(`{"a":1}`, 100))))
+	raw, err := inner.Get("a.json")
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{int64(len(raw))}, sized.sizes)
+}
+
+func TestSpoolBuffer(t *testing.T) {
+	var buf = &spoolBuffer{limit: 8}
+
+	buf.Write([]byte("hello"))
+	assert.Nil(t, buf.file)
+	buf.Write([]byte(", world"))
+	assert.NotNil(t, buf.file)
+	assert.Equal(t, int64(12), buf.size)
+
+	r, err := buf.reader()
+	assert.NoError(t, err)
+	b, err := ioutil.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello, world", string(b))
+
+	name := buf.file.Name()
+	assert.NoError(t, buf.Close())
+	_, err = os.Stat(name)
+	assert.True(t, os.IsNotExist(err))
+}
+
+// objectServer 按 S3 协议保存对象, 下载时原样返回上传时的 Content-Encoding 与用户元数据
+type objectServer struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	headers map[string]http.Header
+}
+
+func (srv *objectServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		b, _ := ioutil.ReadAll(r.Body)
+		var header = http.Header{}
+		for k, v := range r.Header {
+			if k == "Content-Type" || k == "Content-Encoding" || strings.HasPrefix(k, "X-Amz-Meta-") {
+				header[k] = v
+			}
+		}
+		srv.objects[r.URL.Path], srv.headers[r.URL.Path] = b, header
+		w.Header().Set("ETag", `"etag"`)
+		return
+	}
+
+	b, ok := srv.objects[r.URL.Path]
+	if !ok {
+		w.Header().Set("Content-Type", "application/xml")
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`)
+		return
+	}
+
+	for k, v := range srv.headers[r.URL.Path] {
+		w.Header()[k] = v
+	}
+	w.Header().Set("Content-Length", fmt.Sprint(len(b)))
+	w.Header().Set("ETag", `"etag"`)
+	if r.Method == http.MethodGet {
+		w.Write(b)
+	}
+}
+
+func TestCompressedStorage_s3(t *testing.T) {
+	fake := &objectServer{objects: make(map[string][]byte), headers: make(map[string]http.Header)}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:           aws.String("us-east-1"),
+		Endpoint:         aws.String(srv.URL),
+		S3ForcePathStyle: aws.Bool(true),
+		Credentials:      credentials.NewStaticCredentials("key", "secret", ""),
+	}))
+	inner, err := NewS3("key", "secret", "compressed-s3", sess, S3Registry(NewRegistry()))
+	assert.NoError(t, err)
+	store, err := NewCompressed(inner)
+	assert.NoError(t, err)
+
+	// 返回 Content-Encoding: gzip 时 net/http 会自动解压, 压缩算法只记录在元数据中
+	var logs = []byte(strings.Repeat(`{"level":"info"}`+"\n", 100))
+	assert.NoError(t, store.Put("app.log", logs))
+	assert.Empty(t, fake.headers["/compressed-s3/app.log"].Get("Content-Encoding"))
+	assert.Less(t, len(fake.objects["/compressed-s3/app.log"]), len(logs))
+
+	got, err := store.Get("app.log")
+	assert.NoError(t, err)
+	assert.Equal(t, logs, got)
+
+	// 原样保存的 gzip 内容不会被解压两次
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write(logs)
+	w.Close()
+	assert.NoError(t, store.PutObject("app.log.gz", bytes.NewReader(gz.Bytes()), int64(gz.Len()), PutOptions{ContentEncoding: "gzip"}))
+	assert.Equal(t, "gzip", fake.headers["/compressed-s3/app.log.gz"].Get("Content-Encoding"))
+	got, err = store.Get("app.log.gz")
+	assert.NoError(t, err)
+	assert.Equal(t, logs, got)
+}
@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"context"
+)
+
+// CopyOptions 复制对象的选项
+//
+// SourceBucket 为源对象所在的存储空间, 默认与目标相同; Metadata 不为 nil 或
+// ContentType 不为空时替换目标对象的元数据, 否则保留源对象的元数据;
+// SourceEncryption 为源对象的 SSE-C 密钥, 默认与目标对象相同
+type CopyOptions struct {
+	SourceBucket     string
+	Metadata         map[string]string
+	ContentType      string
+	SourceEncryption *Encryption
+}
+
+type CopyOptionFunc func(*CopyOptions)
+
+// CopySourceBucket 从同一个后端的其它存储空间复制
+func CopySourceBucket(bucket string) CopyOptionFunc {
+	return func(opts *CopyOptions) {
+		opts.SourceBucket = bucket
+	}
+}
+
+// CopyMetadata 替换目标对象的用户元数据
+func CopyMetadata(metadata map[string]string) CopyOptionFunc {
+	return func(opts *CopyOptions) {
+		if metadata == nil {
+			metadata = make(map[string]string)
+		}
+		opts.Metadata = metadata
+	}
+}
+
+// CopySourceEncryption 源对象使用 SSE-C 加密时提供源对象的密钥
+func CopySourceEncryption(enc *Encryption) CopyOptionFunc {
+	return func(opts *CopyOptions) {
+		opts.SourceEncryption = enc
+	}
+}
+
+// CopyContentType 替换目标对象的 Content-Type
+func CopyContentType(contentType string) CopyOptionFunc {
+	return func(opts *CopyOptions) {
+		opts.ContentType = contentType
+	}
+}
+
+func newCopyOptions(bucket string, opts []CopyOptionFunc) CopyOptions {
+	var copts CopyOptions
+	for _, opt := range opts {
+		opt(&copts)
+	}
+	if copts.SourceBucket == "" {
+		copts.SourceBucket = bucket
+	}
+	return copts
+}
+
+// replace 是否替换元数据
+func (opts CopyOptions) replace() bool {
+	return opts.Metadata != nil || opts.ContentType != ""
+}
+
+// Copier 支持服务端复制的存储
+type Copier interface {
+	Copy(dest, from string, opts ...CopyOptionFunc) error
+	CopyContext(ctx context.Context, dest, from string, opts ...CopyOptionFunc) error
+}
+
+// sameBackend 判断能否从 src 所在的存储空间进行服务端复制
+type sameBackend interface {
+	sameBackend(src Storage) bool
+}
+
+// Copy 将 src 中的 srcKey 复制为 dst 中的 destKey
+//
+// dst 与 src 为同一个存储, 或同一个后端的不同存储空间时使用服务端复制, 否则
+// 从 src 下载后上传到 dst, 这时 dst 需要实现 Putter 才能保留或替换元数据
+func Copy(ctx context.Context, dst Storage, destKey string, src Storage, srcKey string, opts ...CopyOptionFunc) error {
+	if copier, ok := dst.(Copier); ok {
+		if dst == src {
+			return copier.CopyContext(ctx, destKey, srcKey, opts...)
+		}
+
+		if same, ok := dst.(sameBackend); ok && same.sameBackend(src) {
+			opts = append(opts, CopySourceBucket(src.BucketName()))
+			return copier.CopyContext(ctx, destKey, srcKey, opts...)
+		}
+	}
+
+	var copts = newCopyOptions("", opts)
+	if _, ok := dst.(Putter); !ok && copts.replace() {
+		return newError("copy", srcKey, ErrNotImplemented, nil)
+	}
+	return copyStream(ctx, dst, destKey, src, srcKey, copts)
+}
+
+// copyStream 流式复制, 不会把整个对象读入内存; 存储类型在不同后端间含义不同, 不复制
+func copyStream(ctx context.Context, dst Storage, destKey string, src Storage, srcKey string, copts CopyOptions) error {
+	var srcCtx = AdaptContext(src)
+
+	info, err := srcCtx.StatContext(ctx, srcKey)
+	if err != nil {
+		return err
+	}
+
+	body, err := srcCtx.OpenContext(ctx, srcKey)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	var opts PutOptions
+	if meta := MetaOf(info); meta != nil {
+		opts = PutOptions{
+			ContentType:        meta.ContentType,
+			ContentDisposition: meta.ContentDisposition,
+			CacheControl:       meta.CacheControl,
+			ContentEncoding:    meta.ContentEncoding,
+			Metadata:           meta.Metadata,
+		}
+	}
+	if copts.Metadata != nil {
+		opts.Metadata = copts.Metadata
+	}
+	if copts.ContentType != "" {
+		opts.ContentType = copts.ContentType
+	}
+
+	return PutObject(ctx, dst, destKey, body, info.Size(), opts)
+}
@@ -0,0 +1,265 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCopyOptions(t *testing.T) {
+	opts := newCopyOptions("bucket", nil)
+	assert.Equal(t, "bucket", opts.SourceBucket)
+	assert.False(t, opts.replace())
+
+	opts = newCopyOptions("bucket", []CopyOptionFunc{CopySourceBucket("other"), CopyMetadata(nil)})
+	assert.Equal(t, "other", opts.SourceBucket)
+	assert.NotNil(t, opts.Metadata)
+	assert.True(t, opts.replace())
+
+	assert.True(t, newCopyOptions("bucket", []CopyOptionFunc{CopyContentType("text/plain")}).replace())
+}
+
+func TestMemoryStorage_Copy(t *testing.T) {
+	store, err := NewMemory("copy", MemoryRegistry(NewRegistry()))
+	assert.NoError(t, err)
+	assert.NoError(t, store.Put("a.txt", []byte("hello")))
+
+	assert.NoError(t, store.Copy("b.txt", "/a.txt"))
+	content, err := store.Get("b.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(content))
+	assert.True(t, store.Exist("a.txt"))
+
+	err = store.Copy("c.json", "a.txt", CopyMetadata(map[string]string{"owner": "alice"}), CopyContentType("application/json"))
+	assert.NoError(t, err)
+	info, err := store.Stat("c.json")
+	assert.NoError(t, err)
+	meta := MetaOf(info)
+	assert.Equal(t, "application/json", meta.ContentType)
+	assert.Equal(t, map[string]string{"owner": "alice"}, meta.Metadata)
+
+	// 源对象的元数据不受影响
+	info, err = store.Stat("a.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "text/plain; charset=utf-8", MetaOf(info).ContentType)
+	assert.Nil(t, MetaOf(info).Metadata)
+
+	err = store.Copy("d.txt", "missing.txt")
+	assert.True(t, errors.Is(err, ErrNotExist))
+
+	err = store.Copy("d.txt", "a.txt", CopySourceBucket("other"))
+	assert.True(t, errors.Is(err, ErrNotImplemented))
+}
+
+func TestLocalStorage_Copy(t *testing.T) {
+	store, err := NewLocal(t.TempDir(), LocalRegistry(NewRegistry()))
+	assert.NoError(t, err)
+	assert.NoError(t, store.Put("a.txt", []byte("hello")))
+
+	assert.NoError(t, store.Copy("dir/b.txt", "a.txt"))
+	content, err := store.Get("dir/b.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(content))
+	assert.True(t, store.Exist("a.txt"))
+
+	err = store.Copy("c.txt", "a.txt", CopyContentType("text/html"))
+	assert.True(t, errors.Is(err, ErrNotImplemented))
+	err = store.Copy("c.txt", "missing.txt")
+	assert.True(t, errors.Is(err, ErrNotExist))
+}
+
+func TestFastdfsStorage_Copy(t *testing.T) {
+	fake := &fakeFastdfs{files: make(map[string][]byte)}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	store, err := NewFastdfs(srv.URL, "token", FastdfsWithIndex(NewFastdfsMemoryIndex()), FastdfsRegistry(NewRegistry()))
+	assert.NoError(t, err)
+	assert.NoError(t, store.Put("a.txt", []byte("hello")))
+	assert.NoError(t, store.Put("b.txt", []byte("world")))
+
+	// 覆盖 b.txt 后不再被引用的文件被删除
+	assert.NoError(t, store.Copy("b.txt", "a.txt"))
+	assert.Len(t, fake.files, 1)
+	content, err := store.Get("b.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(content))
+
+	// 删除其中一个 key 不影响另一个
+	assert.NoError(t, store.Remove("a.txt"))
+	assert.Len(t, fake.files, 1)
+	assert.True(t, store.Exist("b.txt"))
+}
+
+func TestCopy(t *testing.T) {
+	var ctx = context.Background()
+
+	mem, err := NewMemory("copy-src", MemoryRegistry(NewRegistry()))
+	assert.NoError(t, err)
+	local, err := NewLocal(t.TempDir(), LocalRegistry(NewRegistry()))
+	assert.NoError(t, err)
+	assert.NoError(t, mem.Put("a.txt", []byte("hello")))
+
+	// 同一个存储使用服务端复制
+	assert.NoError(t, Copy(ctx, mem, "b.txt", mem, "a.txt", CopyContentType("text/markdown")))
+	info, err := mem.Stat("b.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "text/markdown", MetaOf(info).ContentType)
+
+	// 不同的存储之间流式复制
+	assert.NoError(t, Copy(ctx, local, "a.txt", mem, "a.txt"))
+	content, err := local.Get("a.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(content))
+
+	assert.NoError(t, Copy(ctx, plainStorage{mem}, "c.txt", local, "a.txt"))
+	assert.True(t, mem.Exist("c.txt"))
+
+	err = Copy(ctx, plainStorage{local}, "b.txt", mem, "a.txt", CopyMetadata(map[string]string{"k": "v"}))
+	assert.True(t, errors.Is(err, ErrNotImplemented))
+	err = Copy(ctx, local, "b.txt", mem, "missing.txt")
+	assert.True(t, errors.Is(err, ErrNotExist))
+}
+
+func TestCopy_Metadata(t *testing.T) {
+	var ctx = context.Background()
+
+	src, err := NewMemory("copy-meta-src", MemoryRegistry(NewRegistry()))
+	assert.NoError(t, err)
+	dst, err := NewMemory("copy-meta-dst", MemoryRegistry(NewRegistry()))
+	assert.NoError(t, err)
+
+	err = src.PutObject("a.bin", strings.NewReader("hello"), 5, PutOptions{
+		ContentType:  "text/plain",
+		CacheControl: "max-age=60",
+		Metadata:     map[string]string{"owner": "alice"},
+	})
+	assert.NoError(t, err)
+
+	// 流式复制保留源对象的元数据
+	assert.NoError(t, Copy(ctx, dst, "a.bin", src, "a.bin"))
+	info, err := dst.Stat("a.bin")
+	assert.NoError(t, err)
+	assert.Equal(t, "text/plain", MetaOf(info).ContentType)
+	assert.Equal(t, "max-age=60", MetaOf(info).CacheControl)
+	assert.Equal(t, map[string]string{"owner": "alice"}, MetaOf(info).Metadata)
+
+	assert.NoError(t, Copy(ctx, dst, "b.bin", src, "a.bin", CopyMetadata(map[string]string{"owner": "bob"})))
+	info, err = dst.Stat("b.bin")
+	assert.NoError(t, err)
+	assert.Equal(t, "text/plain", MetaOf(info).ContentType)
+	assert.Equal(t, map[string]string{"owner": "bob"}, MetaOf(info).Metadata)
+}
+
+// copyServer 按 S3 协议提供 /<bucket>/src.bin 的元数据, 记录复制相关的请求
+type copyServer struct {
+	mu       sync.Mutex
+	size     int64
+	requests []*http.Request
+}
+
+func (srv *copyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodHead:
+		if !strings.HasSuffix(r.URL.Path, "/src.bin") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.FormatInt(srv.size, 10))
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("X-Amz-Meta-Owner", "alice")
+		w.Header().Set("ETag", `"etag"`)
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		return
+	case r.Method == http.MethodPost && r.URL.Query().Has("uploads"):
+		fmt.Fprint(w, `<InitiateMultipartUploadResult><UploadId>upload</UploadId></InitiateMultipartUploadResult>`)
+	case r.Method == http.MethodPut && r.URL.Query().Has("uploadId"):
+		fmt.Fprint(w, `<CopyPartResult><ETag>"part"</ETag></CopyPartResult>`)
+	case r.Method == http.MethodPost:
+		fmt.Fprint(w, `<CompleteMultipartUploadResult><Bucket>copy-minio</Bucket><Key>dst.bin</Key><ETag>"etag"</ETag></CompleteMultipartUploadResult>`)
+	default:
+		fmt.Fprint(w, `<CopyObjectResult><ETag>"etag"</ETag></CopyObjectResult>`)
+	}
+	srv.requests = append(srv.requests, r)
+}
+
+// find 返回第一个方法与查询参数匹配的请求
+func (srv *copyServer) find(method, query string) *http.Request {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	for _, r := range srv.requests {
+		if r.Method == method && r.URL.Query().Has(query) {
+			return r
+		}
+	}
+	return nil
+}
+
+func TestMinioStorage_Copy(t *testing.T) {
+	fake := &copyServer{size: 5}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	store, err := NewMinio("key", "secret", "copy-minio", MinioEndpoint(strings.TrimPrefix(srv.URL, "http://")), MinioRegion("us-east-1"), MinioRegistry(NewRegistry()))
+	assert.NoError(t, err)
+
+	// 空的 Metadata 也会清空源对象的元数据
+	assert.NoError(t, store.Copy("dst.bin", "/src.bin", CopyMetadata(map[string]string{})))
+	assert.Len(t, fake.requests, 1)
+	header := fake.requests[0].Header
+	assert.Equal(t, "copy-minio/src.bin", header.Get("X-Amz-Copy-Source"))
+	assert.Equal(t, "REPLACE", header.Get("X-Amz-Metadata-Directive"))
+	assert.Equal(t, "application/pdf", header.Get("Content-Type"))
+	assert.Empty(t, header.Get("X-Amz-Meta-Owner"))
+
+	// 大于 5GiB 的对象分片复制, 并带上源对象的元数据
+	fake.requests, fake.size = nil, 6<<30
+	assert.NoError(t, store.Copy("dst.bin", "src.bin"))
+	header = fake.find(http.MethodPost, "uploads").Header
+	assert.Equal(t, "application/pdf", header.Get("Content-Type"))
+	assert.Equal(t, "max-age=60", header.Get("Cache-Control"))
+	assert.Equal(t, "alice", header.Get("X-Amz-Meta-Owner"))
+	assert.Equal(t, "bytes=0-536870911", fake.find(http.MethodPut, "partNumber").Header.Get("X-Amz-Copy-Source-Range"))
+
+	err = store.Copy("dst.bin", "missing.bin")
+	assert.True(t, errors.Is(err, ErrNotExist))
+}
+
+func TestS3ObjectStorage_Copy(t *testing.T) {
+	fake := &copyServer{size: 6 << 30}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:           aws.String("us-east-1"),
+		Endpoint:         aws.String(srv.URL),
+		S3ForcePathStyle: aws.Bool(true),
+		Credentials:      credentials.NewStaticCredentials("key", "secret", ""),
+	}))
+	store, err := NewS3("key", "secret", "copy-s3", sess, S3Registry(NewRegistry()))
+	assert.NoError(t, err)
+
+	// 分片复制与 CopyObject 一样沿用源对象的元数据与标准头部
+	assert.NoError(t, store.Copy("dst.bin", "src.bin"))
+	header := fake.find(http.MethodPost, "uploads").Header
+	assert.Equal(t, "application/pdf", header.Get("Content-Type"))
+	assert.Equal(t, "max-age=60", header.Get("Cache-Control"))
+	assert.Equal(t, "alice", header.Get("X-Amz-Meta-Owner"))
+}
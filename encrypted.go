@@ -0,0 +1,585 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+const (
+	// encryptedHeaderSize 对象开头的定长头部, 定长使得密文大小可以直接换算为明文大小,
+	// Rekey 替换头部时对象大小也不变
+	encryptedHeaderSize = 512
+	// encryptedChunkSize 每个 AES-GCM 分块的明文大小
+	encryptedChunkSize = 64 << 10
+	// encryptedDataKeyLen 每个对象随机生成的 AES-256 数据密钥
+	encryptedDataKeyLen = 32
+	// aesTagSize AES-GCM 认证标签的长度
+	aesTagSize = 16
+)
+
+// encryptedMagic 头部的魔数与版本
+var encryptedMagic = []byte("HSE\x01")
+
+// KeyProvider 管理加密数据密钥的主密钥
+//
+// WrapKey 使用当前的主密钥加密数据密钥并返回主密钥的 ID, UnwrapKey 使用 ID 对应的
+// 主密钥解密; 轮换主密钥时保留旧的主密钥用于解密, 再通过 Rekey 迁移已有的对象
+type KeyProvider interface {
+	WrapKey(dataKey []byte) (keyID string, wrapped []byte, err error)
+	UnwrapKey(keyID string, wrapped []byte) (dataKey []byte, err error)
+}
+
+// staticKeyProvider 使用本地 AES 主密钥的 KeyProvider
+type staticKeyProvider struct {
+	current string
+	keys    map[string]cipher.AEAD
+}
+
+// NewStaticKeyProvider 使用本地主密钥, keys 为主密钥 ID 到 16、24 或 32 字节密钥的映射,
+// current 为加密新对象使用的主密钥
+func NewStaticKeyProvider(current string, keys map[string][]byte) (KeyProvider, error) {
+	var provider = &staticKeyProvider{current: current, keys: make(map[string]cipher.AEAD, len(keys))}
+	for id, key := range keys {
+		aead, err := newGCM(key)
+		if err != nil {
+			return nil, newError("encrypt", "", ErrInvalid, fmt.Errorf("master key %q: %w", id, err))
+		}
+		provider.keys[id] = aead
+	}
+
+	if _, ok := provider.keys[current]; !ok {
+		return nil, newError("encrypt", "", ErrInvalid, fmt.Errorf("unknown current master key %q", current))
+	}
+	return provider, nil
+}
+
+// WrapKey 返回 nonce 与密文, 主密钥 ID 作为附加数据
+func (provider *staticKeyProvider) WrapKey(dataKey []byte) (string, []byte, error) {
+	aead := provider.keys[provider.current]
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", nil, err
+	}
+	return provider.current, aead.Seal(nonce, nonce, dataKey, []byte(provider.current)), nil
+}
+
+func (provider *staticKeyProvider) UnwrapKey(keyID string, wrapped []byte) ([]byte, error) {
+	aead, ok := provider.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown master key %q", keyID)
+	}
+
+	if len(wrapped) < aead.NonceSize() {
+		return nil, errors.New("wrapped key too short")
+	}
+	return aead.Open(nil, wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():], []byte(keyID))
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// EncryptedStorage 客户端加密的存储, 适用于不支持服务端加密的后端 (例如七牛)
+//
+// 每个对象使用随机的数据密钥按 64KiB 分块做 AES-GCM 加密, 数据密钥由 KeyProvider
+// 加密后与 nonce 一起保存在对象开头的定长头部中; 读取时透明解密, List 与 Stat
+// 返回明文大小. 密文不能直接通过 WebURL 访问
+type EncryptedStorage struct {
+	Storage
+
+	keys KeyProvider
+}
+
+// NewEncrypted 包装 store, 使用 keys 管理数据密钥
+func NewEncrypted(store Storage, keys KeyProvider) (*EncryptedStorage, error) {
+	if store == nil || keys == nil {
+		return nil, newError("encrypt", "", ErrInvalid, errors.New("nil storage or key provider"))
+	}
+	return &EncryptedStorage{Storage: store, keys: keys}, nil
+}
+
+// encryptedHeader 对象的头部
+type encryptedHeader struct {
+	keyID   string
+	wrapped []byte
+	nonce   []byte
+}
+
+func (h *encryptedHeader) marshal() ([]byte, error) {
+	var buf = bytes.NewBuffer(make([]byte, 0, encryptedHeaderSize))
+	buf.Write(encryptedMagic)
+	binary.Write(buf, binary.BigEndian, uint32(encryptedChunkSize))
+	buf.Write(h.nonce)
+	buf.WriteByte(byte(len(h.keyID)))
+	buf.WriteString(h.keyID)
+	binary.Write(buf, binary.BigEndian, uint16(len(h.wrapped)))
+	buf.Write(h.wrapped)
+
+	if len(h.keyID) > 255 || buf.Len() > encryptedHeaderSize {
+		return nil, errors.New("key id or wrapped key too long")
+	}
+
+	var header = make([]byte, encryptedHeaderSize)
+	copy(header, buf.Bytes())
+	return header, nil
+}
+
+func parseEncryptedHeader(b []byte) (*encryptedHeader, error) {
+	var errInvalid = errors.New("not an encrypted object")
+
+	if len(b) != encryptedHeaderSize || !bytes.HasPrefix(b, encryptedMagic) {
+		return nil, errInvalid
+	}
+
+	r := bytes.NewReader(b[len(encryptedMagic):])
+
+	var chunkSize uint32
+	binary.Read(r, binary.BigEndian, &chunkSize)
+	if chunkSize != encryptedChunkSize {
+		return nil, fmt.Errorf("unsupported chunk size %d", chunkSize)
+	}
+
+	var h = &encryptedHeader{nonce: make([]byte, 12)}
+	if _, err := io.ReadFull(r, h.nonce); err != nil {
+		return nil, errInvalid
+	}
+
+	n, err := r.ReadByte()
+	if err != nil {
+		return nil, errInvalid
+	}
+	keyID := make([]byte, n)
+	if _, err = io.ReadFull(r, keyID); err != nil {
+		return nil, errInvalid
+	}
+	h.keyID = string(keyID)
+
+	var wrappedLen uint16
+	if err = binary.Read(r, binary.BigEndian, &wrappedLen); err != nil {
+		return nil, errInvalid
+	}
+	h.wrapped = make([]byte, wrappedLen)
+	if _, err = io.ReadFull(r, h.wrapped); err != nil {
+		return nil, errInvalid
+	}
+	return h, nil
+}
+
+// plaintextSize 由密文大小换算明文大小, 每个分块有 16 字节的认证标签
+func plaintextSize(size int64) int64 {
+	var body = size - encryptedHeaderSize
+	if body < aesTagSize {
+		return size
+	}
+
+	chunks := (body + encryptedChunkSize + aesTagSize - 1) / (encryptedChunkSize + aesTagSize)
+	return body - chunks*aesTagSize
+}
+
+// ciphertextSize 由明文大小换算密文大小, 空对象也有一个分块; size < 0 表示未知
+func ciphertextSize(size int64) int64 {
+	if size < 0 {
+		return -1
+	}
+
+	chunks := (size + encryptedChunkSize - 1) / encryptedChunkSize
+	if chunks == 0 {
+		chunks = 1
+	}
+	return encryptedHeaderSize + size + chunks*aesTagSize
+}
+
+// chunkNonce 将分块序号异或到 nonce 的后 8 字节
+func chunkNonce(base []byte, index uint64) []byte {
+	var nonce = append([]byte(nil), base...)
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], index)
+	for i := range counter {
+		nonce[len(nonce)-8+i] ^= counter[i]
+	}
+	return nonce
+}
+
+// chunkAAD 最后一个分块带有结束标记, 防止截断
+func chunkAAD(final bool) []byte {
+	if final {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// encryptReader 边读边加密, 先输出头部再逐块输出密文
+type encryptReader struct {
+	src   *bufio.Reader
+	aead  cipher.AEAD
+	nonce []byte
+	index uint64
+	buf   []byte
+	out   []byte
+	done  bool
+}
+
+func (store *EncryptedStorage) encrypt(r io.Reader) (io.Reader, error) {
+	dataKey := make([]byte, encryptedDataKeyLen)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+
+	keyID, wrapped, err := store.keys.WrapKey(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var h = &encryptedHeader{keyID: keyID, wrapped: wrapped, nonce: make([]byte, aead.NonceSize())}
+	if _, err = rand.Read(h.nonce); err != nil {
+		return nil, err
+	}
+
+	header, err := h.marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	return &encryptReader{
+		src:   bufio.NewReaderSize(r, encryptedChunkSize),
+		aead:  aead,
+		nonce: h.nonce,
+		buf:   make([]byte, encryptedChunkSize),
+		out:   header,
+	}, nil
+}
+
+func (r *encryptReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.next(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+// next 读取并加密下一个分块, 读满一块后预读一个字节判断是否为最后一块
+func (r *encryptReader) next() error {
+	n, err := io.ReadFull(r.src, r.buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+
+	final := n < len(r.buf)
+	if !final {
+		if _, err = r.src.Peek(1); err == io.EOF {
+			final = true
+		} else if err != nil {
+			return err
+		}
+	}
+
+	r.out = r.aead.Seal(r.out[:0], chunkNonce(r.nonce, r.index), r.buf[:n], chunkAAD(final))
+	r.index++
+	r.done = final
+	return nil
+}
+
+// decryptReader 边读边解密, 校验每个分块的认证标签与结束标记
+type decryptReader struct {
+	key   string
+	src   *bufio.Reader
+	body  io.Closer
+	aead  cipher.AEAD
+	nonce []byte
+	index uint64
+	buf   []byte
+	out   []byte
+	done  bool
+}
+
+// decrypt 读取头部并解开数据密钥, 返回解密后的读取流
+func (store *EncryptedStorage) decrypt(key string, body io.ReadCloser) (io.ReadCloser, error) {
+	var header = make([]byte, encryptedHeaderSize)
+	if _, err := io.ReadFull(body, header); err != nil {
+		return nil, newError("decrypt", key, ErrInvalid, errors.New("not an encrypted object"))
+	}
+
+	h, err := parseEncryptedHeader(header)
+	if err != nil {
+		return nil, newError("decrypt", key, ErrInvalid, err)
+	}
+
+	dataKey, err := store.keys.UnwrapKey(h.keyID, h.wrapped)
+	if err != nil {
+		return nil, newError("decrypt", key, ErrPermission, err)
+	}
+
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, newError("decrypt", key, ErrInvalid, err)
+	}
+
+	return &decryptReader{
+		key:   key,
+		src:   bufio.NewReaderSize(body, encryptedChunkSize+aesTagSize),
+		body:  body,
+		aead:  aead,
+		nonce: h.nonce,
+		buf:   make([]byte, encryptedChunkSize+aesTagSize),
+	}, nil
+}
+
+func (r *decryptReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.next(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+func (r *decryptReader) next() error {
+	n, err := io.ReadFull(r.src, r.buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+
+	final := n < len(r.buf)
+	if !final {
+		if _, err = r.src.Peek(1); err == io.EOF {
+			final = true
+		} else if err != nil {
+			return err
+		}
+	}
+
+	r.out, err = r.aead.Open(r.out[:0], chunkNonce(r.nonce, r.index), r.buf[:n], chunkAAD(final))
+	if err != nil {
+		return newError("decrypt", r.key, ErrInvalid, errors.New("ciphertext is corrupted or truncated"))
+	}
+	r.index++
+	r.done = final
+	return nil
+}
+
+func (r *decryptReader) Close() error {
+	return r.body.Close()
+}
+
+// plainInfo 将密文对象的信息换算为明文大小
+func plainInfo(info os.FileInfo) os.FileInfo {
+	if info == nil || info.IsDir() {
+		return info
+	}
+
+	return &ObjectInfo{
+		key:  info.Name(),
+		size: plaintextSize(info.Size()),
+		time: info.ModTime(),
+		meta: MetaOf(info),
+	}
+}
+
+func (store *EncryptedStorage) List(prefix string) ([]os.FileInfo, error) {
+	objects, err := store.Storage.List(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, info := range objects {
+		objects[i] = plainInfo(info)
+	}
+	return objects, nil
+}
+
+// ListObjects 按页列举底层存储, 换算每个对象的明文大小
+func (store *EncryptedStorage) ListObjects(ctx context.Context, opts ListOptions) *ObjectIterator {
+	inner := Iterate(ctx, store.Storage, opts)
+	return newObjectIterator(ctx, opts, func(ctx context.Context, token string) ([]os.FileInfo, string, error) {
+		var page []os.FileInfo
+		for len(page) < listPageSize && inner.Next() {
+			page = append(page, plainInfo(inner.Object()))
+		}
+		if err := inner.Err(); err != nil {
+			return nil, "", err
+		}
+
+		if len(page) < listPageSize {
+			return page, "", nil
+		}
+		return page, "more", nil
+	})
+}
+
+func (store *EncryptedStorage) Stat(key string) (os.FileInfo, error) {
+	info, err := store.Storage.Stat(key)
+	if err != nil {
+		return nil, err
+	}
+	return plainInfo(info), nil
+}
+
+func (store *EncryptedStorage) Get(key string) ([]byte, error) {
+	body, err := store.Open(key)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, newError("get", key, nil, err)
+	}
+	return b, nil
+}
+
+// Open 打开解密后的读取流, 分块的认证失败时 Read 返回 ErrInvalid
+func (store *EncryptedStorage) Open(key string) (io.ReadCloser, error) {
+	body, err := store.Storage.Open(key)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := store.decrypt(key, body)
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+func (store *EncryptedStorage) PutFile(key string, file string) error {
+	return putFile(context.Background(), store, key, file)
+}
+
+func (store *EncryptedStorage) Put(key string, val []byte) error {
+	return store.PutReader(key, bytes.NewReader(val), int64(len(val)))
+}
+
+func (store *EncryptedStorage) PutReader(key string, r io.Reader, size int64) error {
+	return store.PutObjectContext(context.Background(), key, r, size, PutOptions{})
+}
+
+func (store *EncryptedStorage) PutObject(key string, r io.Reader, size int64, opts PutOptions) error {
+	return store.PutObjectContext(context.Background(), key, r, size, opts)
+}
+
+// PutObjectContext 加密后上传, ContentType 由明文推断后原样交给底层存储
+func (store *EncryptedStorage) PutObjectContext(ctx context.Context, key string, r io.Reader, size int64, opts PutOptions) error {
+	r, err := opts.detect(key, r)
+	if err != nil {
+		return err
+	}
+
+	encrypted, err := store.encrypt(r)
+	if err != nil {
+		return newError("put", key, nil, err)
+	}
+	return PutObject(ctx, store.Storage, key, encrypted, ciphertextSize(size), opts)
+}
+
+func (store *EncryptedStorage) Copy(dest string, from string, opts ...CopyOptionFunc) error {
+	return store.CopyContext(context.Background(), dest, from, opts...)
+}
+
+// CopyContext 密文原样复制, 数据密钥随头部一起复制
+func (store *EncryptedStorage) CopyContext(ctx context.Context, dest string, from string, opts ...CopyOptionFunc) error {
+	return Copy(ctx, store.Storage, dest, store.Storage, from, opts...)
+}
+
+// WebURL 密文不能直接访问
+func (store *EncryptedStorage) WebURL(key string) (string, error) {
+	return "", newError("weburl", key, ErrNotImplemented, errors.New("encrypted objects cannot be served directly"))
+}
+
+// Rekey 使用 KeyProvider 当前的主密钥重新加密 key 的数据密钥, 只替换头部,
+// 对象内容不需要重新加密; 已经使用当前主密钥时不做修改
+func (store *EncryptedStorage) Rekey(ctx context.Context, key string) error {
+	var sc = AdaptContext(store.Storage)
+
+	info, err := sc.StatContext(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	body, err := sc.OpenContext(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	var header = make([]byte, encryptedHeaderSize)
+	if _, err = io.ReadFull(body, header); err != nil {
+		return newError("rekey", key, ErrInvalid, errors.New("not an encrypted object"))
+	}
+
+	h, err := parseEncryptedHeader(header)
+	if err != nil {
+		return newError("rekey", key, ErrInvalid, err)
+	}
+
+	dataKey, err := store.keys.UnwrapKey(h.keyID, h.wrapped)
+	if err != nil {
+		return newError("rekey", key, ErrPermission, err)
+	}
+
+	keyID, wrapped, err := store.keys.WrapKey(dataKey)
+	if err != nil {
+		return newError("rekey", key, nil, err)
+	}
+	if keyID == h.keyID {
+		return nil
+	}
+
+	h.keyID, h.wrapped = keyID, wrapped
+	if header, err = h.marshal(); err != nil {
+		return newError("rekey", key, ErrInvalid, err)
+	}
+
+	var opts PutOptions
+	if meta := MetaOf(info); meta != nil {
+		opts = PutOptions{
+			ContentType:        meta.ContentType,
+			ContentDisposition: meta.ContentDisposition,
+			CacheControl:       meta.CacheControl,
+			ContentEncoding:    meta.ContentEncoding,
+			Metadata:           meta.Metadata,
+		}
+	}
+	return PutObject(ctx, store.Storage, key, io.MultiReader(bytes.NewReader(header), body), info.Size(), opts)
+}
+
+var (
+	_ Storage = &EncryptedStorage{}
+	_ Lister  = &EncryptedStorage{}
+	_ Putter  = &EncryptedStorage{}
+	_ Copier  = &EncryptedStorage{}
+)
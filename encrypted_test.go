@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newEncryptedMemory(t *testing.T, keys KeyProvider) (*EncryptedStorage, *MemoryStorage) {
+	inner, err := NewMemory("encrypted", MemoryRegistry(NewRegistry()))
+	assert.NoError(t, err)
+
+	store, err := NewEncrypted(inner, keys)
+	assert.NoError(t, err)
+	return store, inner
+}
+
+func masterKeys(t *testing.T, current string, ids ...string) KeyProvider {
+	var keys = make(map[string][]byte)
+	for _, id := range ids {
+		keys[id] = bytes.Repeat([]byte(id[:1]), 32)
+	}
+
+	provider, err := NewStaticKeyProvider(current, keys)
+	assert.NoError(t, err)
+	return provider
+}
+
+func TestNewStaticKeyProvider(t *testing.T) {
+	_, err := NewStaticKeyProvider("a", map[string][]byte{"a": []byte("short")})
+	assert.True(t, errors.Is(err, ErrInvalid))
+
+	_, err = NewStaticKeyProvider("b", map[string][]byte{"a": bytes.Repeat([]byte("a"), 16)})
+	assert.True(t, errors.Is(err, ErrInvalid))
+
+	_, err = NewEncrypted(nil, masterKeys(t, "a", "a"))
+	assert.True(t, errors.Is(err, ErrInvalid))
+}
+
+func TestEncryptedStorage_Get(t *testing.T) {
+	store, inner := newEncryptedMemory(t, masterKeys(t, "a", "a"))
+
+	for _, size := range []int{0, 5, encryptedChunkSize, encryptedChunkSize + 1, 3*encryptedChunkSize - 7} {
+		var plain = bytes.Repeat([]byte("0123456789"), size/10+1)[:size]
+
+		assert.NoError(t, store.Put("a.bin", plain))
+		got, err := store.Get("a.bin")
+		assert.NoError(t, err)
+		assert.Equal(t, plain, got, size)
+
+		// 底层存储中是密文, List、Stat 返回明文大小
+		raw, err := inner.Get("a.bin")
+		assert.NoError(t, err)
+		assert.Equal(t, ciphertextSize(int64(size)), int64(len(raw)))
+		assert.False(t, bytes.Contains(raw, []byte("0123456789")))
+
+		info, err := store.Stat("a.bin")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(size), info.Size())
+
+		objects, err := store.List("")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(size), objects[0].Size())
+
+		it := store.ListObjects(context.Background(), ListOptions{})
+		assert.True(t, it.Next())
+		assert.Equal(t, int64(size), it.Object().Size())
+		assert.False(t, it.Next())
+		assert.NoError(t, it.Err())
+	}
+}
+
+func TestEncryptedStorage_Tamper(t *testing.T) {
+	store, inner := newEncryptedMemory(t, masterKeys(t, "a", "a"))
+
+	var plain = bytes.Repeat([]byte("x"), 2*encryptedChunkSize+10)
+	assert.NoError(t, store.Put("a.bin", plain))
+	raw, err := inner.Get("a.bin")
+	assert.NoError(t, err)
+
+	// 修改任意分块
+	tampered := append([]byte(nil), raw...)
+	tampered[encryptedHeaderSize+encryptedChunkSize+100] ^= 1
+	assert.NoError(t, inner.Put("a.bin", tampered))
+	_, err = store.Get("a.bin")
+	assert.True(t, errors.Is(err, ErrInvalid))
+
+	// 在分块边界截断
+	assert.NoError(t, inner.Put("a.bin", raw[:encryptedHeaderSize+encryptedChunkSize+aesTagSize]))
+	_, err = store.Get("a.bin")
+	assert.True(t, errors.Is(err, ErrInvalid))
+
+	// 不是加密对象
+	assert.NoError(t, inner.Put("a.bin", []byte("plain")))
+	_, err = store.Get("a.bin")
+	assert.True(t, errors.Is(err, ErrInvalid))
+}
+
+func TestEncryptedStorage_Rekey(t *testing.T) {
+	var ctx = context.Background()
+
+	old, inner := newEncryptedMemory(t, masterKeys(t, "a", "a"))
+	assert.NoError(t, old.Put("a.txt", []byte("hello")))
+
+	// 轮换主密钥后旧对象仍然可以读取
+	store, err := NewEncrypted(inner, masterKeys(t, "b", "a", "b"))
+	assert.NoError(t, err)
+	got, err := store.Get("a.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(got))
+
+	before, _ := inner.Get("a.txt")
+	assert.NoError(t, store.Rekey(ctx, "a.txt"))
+	after, _ := inner.Get("a.txt")
+	assert.Equal(t, len(before), len(after))
+	assert.Equal(t, before[encryptedHeaderSize:], after[encryptedHeaderSize:])
+
+	// 移除旧主密钥后仍然可以读取
+	store, err = NewEncrypted(inner, masterKeys(t, "b", "b"))
+	assert.NoError(t, err)
+	r, err := store.Open("a.txt")
+	assert.NoError(t, err)
+	got, err = ioutil.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(got))
+	assert.NoError(t, r.Close())
+
+	info, err := inner.Stat("a.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "text/plain; charset=utf-8", MetaOf(info).ContentType)
+
+	_, err = old.Get("a.txt")
+	assert.True(t, errors.Is(err, ErrPermission))
+}
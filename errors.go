@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+)
+
+// 各个存储后端共用的错误类型, 后端的原始错误会被映射到这些错误上,
+// 可以使用 errors.Is 判断, 例如 errors.Is(err, storage.ErrNotExist)
+var (
+	ErrNotExist       = errors.New("storage: object does not exist")
+	ErrExist          = errors.New("storage: object already exists")
+	ErrPermission     = errors.New("storage: permission denied")
+	ErrInvalid        = errors.New("storage: invalid argument")
+	ErrNotImplemented = errors.New("storage: not implemented")
+	ErrThrottled      = errors.New("storage: request throttled")
+	ErrUnavailable    = errors.New("storage: service unavailable")
+)
+
+// ErrUnknownBucket BucketURI 对应的存储没有被创建
+var ErrUnknownBucket = errors.New("storage: unknown bucket")
+
+// Error 记录出错的操作、对象以及后端的原始错误
+//
+// Kind 为上面定义的错误之一, 无法归类时为 nil; Err 为后端的原始错误,
+// 可以通过 errors.As 取出 minio.ErrorResponse、awserr.Error 等类型
+type Error struct {
+	Op   string
+	Key  string
+	Kind error
+	Err  error
+}
+
+func (e *Error) Error() string {
+	var msg = "storage: " + e.Op
+	if e.Key != "" {
+		msg += " " + e.Key
+	}
+
+	switch {
+	case e.Err != nil:
+		return msg + ": " + e.Err.Error()
+	case e.Kind != nil:
+		return msg + ": " + e.Kind.Error()
+	default:
+		return msg
+	}
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is 使 errors.Is 可以同时匹配 Kind 以及对应的 io/fs 错误
+func (e *Error) Is(target error) bool {
+	if e.Kind == nil {
+		return false
+	}
+
+	switch target {
+	case e.Kind:
+		return true
+	case fs.ErrNotExist:
+		return e.Kind == ErrNotExist
+	case fs.ErrExist:
+		return e.Kind == ErrExist
+	case fs.ErrPermission:
+		return e.Kind == ErrPermission
+	}
+	return false
+}
+
+// newError 包装后端的原始错误, kind 与 err 都为 nil 时返回 nil
+func newError(op, key string, kind, err error) error {
+	if kind == nil && err == nil {
+		return nil
+	}
+
+	if _, ok := err.(*Error); ok {
+		return err
+	}
+
+	if kind == nil {
+		kind = kindOfError(err)
+	}
+	return &Error{Op: op, Key: key, Kind: kind, Err: err}
+}
+
+// kindOfError 对通用错误进行归类
+func kindOfError(err error) error {
+	for _, kind := range []error{ErrNotExist, ErrExist, ErrPermission, ErrInvalid, ErrNotImplemented, ErrThrottled, ErrUnavailable} {
+		if errors.Is(err, kind) {
+			return kind
+		}
+	}
+
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return ErrNotExist
+	case errors.Is(err, fs.ErrExist):
+		return ErrExist
+	case errors.Is(err, fs.ErrPermission):
+		return ErrPermission
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return ErrUnavailable
+	}
+	return nil
+}
+
+// statusError 将非 2xx 的 http 响应转换为 storage 错误
+func statusError(op, key string, resp *http.Response) error {
+	return newError(op, key, kindOfStatus(resp.StatusCode), fmt.Errorf("unexpected http status %s", resp.Status))
+}
+
+// kindOfStatus 根据 HTTP 状态码归类错误
+func kindOfStatus(code int) error {
+	switch {
+	case code == http.StatusNotFound:
+		return ErrNotExist
+	case code == http.StatusConflict:
+		return ErrExist
+	case code == http.StatusUnauthorized, code == http.StatusForbidden:
+		return ErrPermission
+	case code == http.StatusBadRequest, code == http.StatusRequestedRangeNotSatisfiable:
+		return ErrInvalid
+	case code == http.StatusNotImplemented:
+		return ErrNotImplemented
+	case code == http.StatusTooManyRequests:
+		return ErrThrottled
+	case code >= http.StatusInternalServerError:
+		return ErrUnavailable
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/minio/minio-go"
+	"github.com/qiniu/go-sdk/v7/client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMinioError(t *testing.T) {
+	tests := []struct {
+		err  error
+		kind error
+	}{
+		{minio.ErrorResponse{Code: "NoSuchKey", StatusCode: 404}, ErrNotExist},
+		{minio.ErrorResponse{Code: "AccessDenied", StatusCode: 403}, ErrPermission},
+		{minio.ErrorResponse{Code: "SlowDown", StatusCode: 503}, ErrThrottled},
+		{minio.ErrorResponse{Code: "Unknown", StatusCode: 502}, ErrUnavailable},
+	}
+
+	for _, tt := range tests {
+		err := minioError("get", "a.txt", tt.err)
+		assert.True(t, errors.Is(err, tt.kind), "%v", err)
+
+		var resp minio.ErrorResponse
+		assert.True(t, errors.As(err, &resp))
+	}
+}
+
+func TestS3Error(t *testing.T) {
+	tests := []struct {
+		err  error
+		kind error
+	}{
+		{awserr.New("NoSuchKey", "not found", nil), ErrNotExist},
+		{awserr.NewRequestFailure(awserr.New("NotFound", "", nil), 404, ""), ErrNotExist},
+		{awserr.NewRequestFailure(awserr.New("Custom", "", nil), 403, ""), ErrPermission},
+		{awserr.New("SlowDown", "", nil), ErrThrottled},
+		{awserr.NewRequestFailure(awserr.New("Custom", "", nil), 500, ""), ErrUnavailable},
+	}
+
+	for _, tt := range tests {
+		err := s3Error("get", "a.txt", tt.err)
+		assert.True(t, errors.Is(err, tt.kind), "%v", err)
+	}
+}
+
+func TestQiniuError(t *testing.T) {
+	tests := []struct {
+		err  error
+		kind error
+	}{
+		{&client.ErrorInfo{Code: 612}, ErrNotExist},
+		{&client.ErrorInfo{Code: 614}, ErrExist},
+		{&client.ErrorInfo{Code: 401}, ErrPermission},
+		{&client.ErrorInfo{Code: 573}, ErrThrottled},
+		{&client.ErrorInfo{Code: 599}, ErrUnavailable},
+	}
+
+	for _, tt := range tests {
+		err := qiniuError("stat", "a.txt", tt.err)
+		assert.True(t, errors.Is(err, tt.kind), "%v", err)
+	}
+}
+
+func TestError_Is(t *testing.T) {
+	err := newError("open", "a.txt", ErrNotExist, errors.New("missing"))
+	assert.True(t, errors.Is(err, ErrNotExist))
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+	assert.False(t, errors.Is(err, ErrPermission))
+	assert.Equal(t, "storage: open a.txt: missing", err.Error())
+
+	assert.Nil(t, newError("open", "a.txt", nil, nil))
+}
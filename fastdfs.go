@@ -0,0 +1,666 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FastdfsStorage fastdfs 对象存储, 通过 go-fastdfs 兼容的 HTTP 网关上传与下载
+//
+// FastDFS 会为上传的文件分配文件 ID, 不能指定存储路径, 因此 key 与文件 ID 的对应
+// 关系保存在 Index 中; Move 只修改 Index, 不会重新上传
+//
+// 创建时必须提供持久化的 Index, 只保存在内存中的 Index 需要通过
+// FastdfsWithIndex(NewFastdfsMemoryIndex()) 显式指定
+type FastdfsStorage struct {
+	Endpoint   string
+	Token      string
+	Group      string
+	Scene      string
+	HttpPrefix string
+	Index      FastdfsIndex
+
+	client   *http.Client
+	registry *Registry
+
+	// mu 上传与修改引用时持有读锁, 删除远端文件时持有写锁, 避免删除按内容去重后
+	// 刚被新的 key 引用的文件
+	mu sync.RWMutex
+}
+
+// FastdfsFile FastDFS 中的文件信息, ID 为网关返回的文件路径, 例如 /group1/default/20200101/a.png
+type FastdfsFile struct {
+	ID      string    `json:"id"`
+	MD5     string    `json:"md5"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+}
+
+// FastdfsIndex 保存 key 与 FastDFS 文件的对应关系
+type FastdfsIndex interface {
+	Load(key string) (FastdfsFile, bool)
+	Store(key string, file FastdfsFile) error
+	Delete(key string) error
+	Keys(prefix string) []string
+	// Refs 返回引用文件 ID 的 key 的数量
+	Refs(id string) int
+}
+
+type FastdfsOptionFunc func(*FastdfsStorage) error
+
+// FastdfsGroup 设置 FastDFS 的组名, 默认为 group1
+func FastdfsGroup(group string) FastdfsOptionFunc {
+	return func(fastdfs *FastdfsStorage) error {
+		fastdfs.Group = group
+		return nil
+	}
+}
+
+// FastdfsScene 设置上传的场景
+func FastdfsScene(scene string) FastdfsOptionFunc {
+	return func(fastdfs *FastdfsStorage) error {
+		fastdfs.Scene = scene
+		return nil
+	}
+}
+
+// FastdfsWebPrefix 设置对外访问的 http 前缀, 默认使用 Endpoint
+func FastdfsWebPrefix(url string) FastdfsOptionFunc {
+	return func(fastdfs *FastdfsStorage) error {
+		fastdfs.HttpPrefix = url
+		return nil
+	}
+}
+
+// FastdfsRegistry 注册到指定的注册表, 默认为 DefaultRegistry
+func FastdfsRegistry(registry *Registry) FastdfsOptionFunc {
+	return func(fastdfs *FastdfsStorage) error {
+		fastdfs.registry = registry
+		return nil
+	}
+}
+
+// FastdfsIndexFile 使用 JSON 文件持久化 key 与文件 ID 的对应关系
+func FastdfsIndexFile(file string) FastdfsOptionFunc {
+	return func(fastdfs *FastdfsStorage) (err error) {
+		fastdfs.Index, err = NewFastdfsFileIndex(file)
+		return
+	}
+}
+
+// FastdfsWithIndex 使用自定义的 FastdfsIndex, 例如保存在数据库中
+func FastdfsWithIndex(index FastdfsIndex) FastdfsOptionFunc {
+	return func(fastdfs *FastdfsStorage) error {
+		fastdfs.Index = index
+		return nil
+	}
+}
+
+func NewFastdfs(endpoint, token string, opts ...FastdfsOptionFunc) (store *FastdfsStorage, err error) {
+	store = &FastdfsStorage{
+		Endpoint: strings.TrimRight(endpoint, "/"),
+		Token:    token,
+		Group:    "group1",
+		client:   http.DefaultClient,
+	}
+
+	for _, opt := range opts {
+		if err = opt(store); err != nil {
+			return nil, err
+		}
+	}
+
+	// 只保存在内存中的 Index 重启后会丢失所有的 key, 需要显式指定
+	if store.Index == nil {
+		return nil, newError("fastdfs", "", ErrInvalid, errors.New("missing index"))
+	}
+
+	register(store.registry, "fastdfs", store, store.Hostname())
+
+	return store, nil
+}
+
+func (store *FastdfsStorage) Hostname() string {
+	if Empty(store.HttpPrefix) {
+		return hostname(store.Endpoint)
+	}
+	return hostname(store.HttpPrefix)
+}
+
+func (store *FastdfsStorage) List(prefix string) ([]os.FileInfo, error) {
+	prefix = strings.TrimPrefix(prefix, "/")
+
+	var result = make([]os.FileInfo, 0)
+	for _, key := range store.Index.Keys(prefix) {
+		if file, ok := store.Index.Load(key); ok {
+			result = append(result, fastdfsObjectInfo(key, file))
+		}
+	}
+	return result, nil
+}
+
+func (store *FastdfsStorage) Get(key string) ([]byte, error) {
+	body, err := store.Open(key)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, newError("get", key, nil, err)
+	}
+	return b, nil
+}
+
+// Open 下载 key 对应的文件
+func (store *FastdfsStorage) Open(key string) (io.ReadCloser, error) {
+	return store.OpenRange(context.Background(), key, 0, -1)
+}
+
+func (store *FastdfsStorage) GetRange(key string, offset, length int64) ([]byte, error) {
+	return getRange(store, key, offset, length)
+}
+
+// OpenRange 下载时带上 Range 请求头, 读取文件的部分内容
+func (store *FastdfsStorage) OpenRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	if err := checkRange(key, offset); err != nil {
+		return nil, err
+	}
+
+	file, ok := store.Index.Load(strings.TrimPrefix(key, "/"))
+	if !ok {
+		return nil, newError("open", key, ErrNotExist, nil)
+	}
+
+	if length == 0 {
+		return emptyBody(), nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, store.apiURL(file.ID, nil), nil)
+	if err != nil {
+		return nil, newError("open", key, ErrInvalid, err)
+	}
+
+	if h := rangeHeader(offset, length); h != "" {
+		req.Header.Set("Range", h)
+	}
+
+	resp, err := store.client.Do(req)
+	if err != nil {
+		return nil, newError("open", key, nil, err)
+	}
+	return httpRangeBody("open", key, resp, offset, length)
+}
+
+func (store *FastdfsStorage) PutFile(key string, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return newError("put", key, nil, err)
+	}
+	defer f.Close()
+
+	return store.PutReader(key, f, -1)
+}
+
+func (store *FastdfsStorage) Put(key string, val []byte) error {
+	return store.PutReader(key, bytes.NewReader(val), int64(len(val)))
+}
+
+// PutObject FastDFS 没有元数据, 忽略 opts, 下载时由 go-fastdfs 根据扩展名设置 Content-Type
+func (store *FastdfsStorage) PutObject(key string, r io.Reader, size int64, opts PutOptions) error {
+	return store.PutObjectContext(context.Background(), key, r, size, opts)
+}
+
+func (store *FastdfsStorage) PutObjectContext(ctx context.Context, key string, r io.Reader, size int64, opts PutOptions) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return store.PutReader(key, r, size)
+}
+
+// fastdfsUploadResult go-fastdfs 上传接口的返回值
+type fastdfsUploadResult struct {
+	URL     string `json:"url"`
+	MD5     string `json:"md5"`
+	Path    string `json:"path"`
+	Size    int64  `json:"size"`
+	Mtime   int64  `json:"mtime"`
+	RetCode int    `json:"retcode"`
+	RetMsg  string `json:"retmsg"`
+}
+
+// PutReader 以 multipart 表单流式上传, 并记录 key 与返回的文件 ID
+func (store *FastdfsStorage) PutReader(key string, r io.Reader, size int64) error {
+	key = strings.TrimPrefix(key, "/")
+
+	store.mu.RLock()
+	old, replaced, err := store.upload(key, r)
+	store.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	if replaced {
+		return store.release("put", key, old)
+	}
+	return nil
+}
+
+// upload 上传文件并保存到 Index, 返回被替换的文件; 调用者需要持有读锁
+func (store *FastdfsStorage) upload(key string, r io.Reader) (old FastdfsFile, replaced bool, err error) {
+	var (
+		pr, pw = io.Pipe()
+		form   = multipart.NewWriter(pw)
+	)
+	// 网关提前返回时结束写入表单的 goroutine
+	defer pr.Close()
+
+	go func() {
+		pw.CloseWithError(store.writeForm(form, key, r))
+	}()
+
+	resp, err := store.client.Post(store.apiURL("/"+store.Group+"/upload", nil), form.FormDataContentType(), pr)
+	if err != nil {
+		return old, false, newError("put", key, nil, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return old, false, statusError("put", key, resp)
+	}
+
+	var ret fastdfsUploadResult
+	if err = json.NewDecoder(resp.Body).Decode(&ret); err != nil {
+		return old, false, newError("put", key, nil, err)
+	}
+
+	if ret.RetCode != 0 || ret.Path == "" {
+		return old, false, newError("put", key, nil, fmt.Errorf("fastdfs: upload failed: %s", ret.RetMsg))
+	}
+
+	var file = FastdfsFile{
+		ID:      ret.Path,
+		MD5:     ret.MD5,
+		Size:    ret.Size,
+		ModTime: time.Unix(ret.Mtime, 0),
+	}
+	if ret.Mtime == 0 {
+		file.ModTime = time.Now()
+	}
+
+	old, replaced = store.Index.Load(key)
+	if err = store.Index.Store(key, file); err != nil {
+		return old, false, newError("put", key, nil, err)
+	}
+
+	// FastDFS 按内容去重, 内容相同时会返回同一个文件 ID
+	return old, replaced && old.ID != file.ID, nil
+}
+
+func (store *FastdfsStorage) writeForm(form *multipart.Writer, key string, r io.Reader) error {
+	var fields = map[string]string{"output": "json"}
+	if store.Scene != "" {
+		fields["scene"] = store.Scene
+	}
+	if store.Token != "" {
+		fields["auth_token"] = store.Token
+	}
+
+	for k, v := range fields {
+		if err := form.WriteField(k, v); err != nil {
+			return err
+		}
+	}
+
+	part, err := form.CreateFormFile("file", path.Base(key))
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(part, r); err != nil {
+		return err
+	}
+	return form.Close()
+}
+
+// Move 只修改 Index 中的对应关系
+func (store *FastdfsStorage) Move(dest string, from string) error {
+	dest = strings.TrimPrefix(dest, "/")
+	from = strings.TrimPrefix(from, "/")
+
+	store.mu.RLock()
+	file, ok := store.Index.Load(from)
+	if !ok {
+		store.mu.RUnlock()
+		return newError("move", from, ErrNotExist, nil)
+	}
+
+	old, replaced := store.Index.Load(dest)
+	err := store.Index.Store(dest, file)
+	if err == nil {
+		err = store.Index.Delete(from)
+	}
+	store.mu.RUnlock()
+	if err != nil {
+		return newError("move", dest, nil, err)
+	}
+
+	if replaced && old.ID != file.ID {
+		return store.release("move", dest, old)
+	}
+	return nil
+}
+
+func (store *FastdfsStorage) Copy(dest string, from string, opts ...CopyOptionFunc) error {
+	return store.CopyContext(context.Background(), dest, from, opts...)
+}
+
+// CopyContext 只在 Index 中增加一个引用同一个文件的 key, FastDFS 没有元数据,
+// 不支持替换元数据
+func (store *FastdfsStorage) CopyContext(ctx context.Context, dest string, from string, opts ...CopyOptionFunc) error {
+	var copts = newCopyOptions(store.BucketName(), opts)
+	if copts.SourceBucket != store.BucketName() || copts.replace() {
+		return newError("copy", from, ErrNotImplemented, nil)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	dest = strings.TrimPrefix(dest, "/")
+	from = strings.TrimPrefix(from, "/")
+
+	store.mu.RLock()
+	file, ok := store.Index.Load(from)
+	if !ok {
+		store.mu.RUnlock()
+		return newError("copy", from, ErrNotExist, nil)
+	}
+
+	old, replaced := store.Index.Load(dest)
+	err := store.Index.Store(dest, file)
+	store.mu.RUnlock()
+	if err != nil {
+		return newError("copy", dest, nil, err)
+	}
+
+	if replaced && old.ID != file.ID {
+		return store.release("copy", dest, old)
+	}
+	return nil
+}
+
+// Remove 删除 key, 没有其它 key 引用同一个文件时才删除 FastDFS 中的文件
+func (store *FastdfsStorage) Remove(key string) error {
+	key = strings.TrimPrefix(key, "/")
+
+	file, ok := store.Index.Load(key)
+	if !ok {
+		return nil
+	}
+
+	if err := store.Index.Delete(key); err != nil {
+		return newError("remove", key, nil, err)
+	}
+	return store.release("remove", key, file)
+}
+
+// fastdfsStatus go-fastdfs 管理接口的返回值
+type fastdfsStatus struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// release 删除不再被任何 key 引用的文件, 持有写锁时没有正在进行的上传, 引用数不会改变
+func (store *FastdfsStorage) release(op, key string, file FastdfsFile) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if store.Index.Refs(file.ID) > 0 {
+		return nil
+	}
+
+	var form = url.Values{"path": {file.ID}}
+	resp, err := store.client.PostForm(store.apiURL("/"+store.Group+"/delete", nil), form)
+	if err != nil {
+		return newError(op, key, nil, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return statusError(op, key, resp)
+	}
+
+	var status fastdfsStatus
+	if err = json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return newError(op, key, nil, err)
+	}
+
+	if status.Status != "ok" {
+		return newError(op, key, nil, errors.New("fastdfs: delete failed: "+status.Message))
+	}
+	return nil
+}
+
+func (store *FastdfsStorage) Exist(key string) bool {
+	_, ok := store.Index.Load(strings.TrimPrefix(key, "/"))
+	return ok
+}
+
+func (store *FastdfsStorage) Stat(key string) (os.FileInfo, error) {
+	key = strings.TrimPrefix(key, "/")
+
+	file, ok := store.Index.Load(key)
+	if !ok {
+		return nil, newError("stat", key, ErrNotExist, nil)
+	}
+	return fastdfsObjectInfo(key, file), nil
+}
+
+func fastdfsObjectInfo(key string, file FastdfsFile) *ObjectInfo {
+	return &ObjectInfo{
+		key:  key,
+		size: file.Size,
+		time: file.ModTime,
+		meta: &ObjectMeta{
+			ETag: file.MD5,
+		},
+	}
+}
+
+// apiURL 拼接网关地址, 设置了 Token 时附加 auth_token 参数
+func (store *FastdfsStorage) apiURL(p string, query url.Values) string {
+	if query == nil {
+		query = url.Values{}
+	}
+	if store.Token != "" {
+		query.Set("auth_token", store.Token)
+	}
+
+	var u = store.Endpoint + p
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u
+}
+
+func (store *FastdfsStorage) WebURL(key string) (string, error) {
+	file, ok := store.Index.Load(strings.TrimPrefix(key, "/"))
+	if !ok {
+		return "", newError("weburl", key, ErrNotExist, nil)
+	}
+
+	var prefix = store.HttpPrefix
+	if Empty(prefix) {
+		prefix = store.Endpoint
+	}
+
+	u, err := url.Parse(prefix)
+	if err != nil {
+		return "", err
+	}
+
+	u.Path = path.Join(u.Path, file.ID)
+	return u.String(), nil
+}
+
+// lookupKey 根据 WebURL 的路径反查 key
+func (store *FastdfsStorage) lookupKey(webPath string) (string, bool) {
+	var prefix = store.HttpPrefix
+	if Empty(prefix) {
+		prefix = store.Endpoint
+	}
+
+	if u, err := url.Parse(prefix); err == nil {
+		webPath = "/" + strings.TrimPrefix(strings.TrimPrefix(webPath, strings.TrimRight(u.Path, "/")), "/")
+	}
+
+	for _, key := range store.Index.Keys("") {
+		if file, ok := store.Index.Load(key); ok && file.ID == webPath {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+func (store *FastdfsStorage) BucketName() string {
+	return store.Group
+}
+
+func (store *FastdfsStorage) BucketURI(key string) BucketURI {
+	return BucketURI(fmt.Sprintf("%s://%s/%s", "fastdfs", store.Group, key))
+}
+
+var (
+	_ Storage     = &FastdfsStorage{}
+	_ RangeReader = &FastdfsStorage{}
+	_ Copier      = &FastdfsStorage{}
+	_ Putter      = &FastdfsStorage{}
+)
+
+// fastdfsMapIndex 基于 map 的 FastdfsIndex, file 不为空时每次修改后保存为 JSON 文件
+type fastdfsMapIndex struct {
+	mu    sync.RWMutex
+	file  string
+	files map[string]FastdfsFile
+	refs  map[string]int
+}
+
+// NewFastdfsMemoryIndex 创建只保存在内存中的 FastdfsIndex
+func NewFastdfsMemoryIndex() FastdfsIndex {
+	return &fastdfsMapIndex{files: make(map[string]FastdfsFile), refs: make(map[string]int)}
+}
+
+// NewFastdfsFileIndex 创建保存在 JSON 文件中的 FastdfsIndex, 文件存在时加载已有的记录
+func NewFastdfsFileIndex(file string) (FastdfsIndex, error) {
+	var index = &fastdfsMapIndex{file: file, files: make(map[string]FastdfsFile), refs: make(map[string]int)}
+
+	b, err := ioutil.ReadFile(file)
+	switch {
+	case os.IsNotExist(err):
+		return index, nil
+	case err != nil:
+		return nil, err
+	}
+
+	if err = json.Unmarshal(b, &index.files); err != nil {
+		return nil, err
+	}
+	for _, f := range index.files {
+		index.refs[f.ID]++
+	}
+	return index, nil
+}
+
+func (index *fastdfsMapIndex) Load(key string) (FastdfsFile, bool) {
+	index.mu.RLock()
+	defer index.mu.RUnlock()
+
+	file, ok := index.files[key]
+	return file, ok
+}
+
+func (index *fastdfsMapIndex) Store(key string, file FastdfsFile) error {
+	index.mu.Lock()
+	defer index.mu.Unlock()
+
+	if old, ok := index.files[key]; ok {
+		index.unref(old.ID)
+	}
+	index.files[key] = file
+	index.refs[file.ID]++
+	return index.save()
+}
+
+func (index *fastdfsMapIndex) Delete(key string) error {
+	index.mu.Lock()
+	defer index.mu.Unlock()
+
+	if old, ok := index.files[key]; ok {
+		index.unref(old.ID)
+		delete(index.files, key)
+	}
+	return index.save()
+}
+
+func (index *fastdfsMapIndex) Refs(id string) int {
+	index.mu.RLock()
+	defer index.mu.RUnlock()
+
+	return index.refs[id]
+}
+
+// unref 减少文件的引用数, 调用者需要持有写锁
+func (index *fastdfsMapIndex) unref(id string) {
+	if index.refs[id]--; index.refs[id] <= 0 {
+		delete(index.refs, id)
+	}
+}
+
+func (index *fastdfsMapIndex) Keys(prefix string) []string {
+	index.mu.RLock()
+	defer index.mu.RUnlock()
+
+	var keys = make([]string, 0)
+	for key := range index.files {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// save 写入临时文件后重命名, 调用者需要持有写锁
+func (index *fastdfsMapIndex) save() error {
+	if index.file == "" {
+		return nil
+	}
+
+	b, err := json.Marshal(index.files)
+	if err != nil {
+		return err
+	}
+
+	tmp := index.file + ".tmp"
+	if err = ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Clean(index.file))
+}
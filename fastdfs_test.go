@@ -0,0 +1,165 @@
+package storage
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeFastdfs 模拟 go-fastdfs 的上传、下载与删除接口, 与 FastDFS 相同按内容去重
+type fakeFastdfs struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+func (fake *fakeFastdfs) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	if r.FormValue("auth_token") != "token" {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/group1/upload":
+		f, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		b, _ := ioutil.ReadAll(f)
+		sum := md5.Sum(b)
+		id := "/group1/default/" + hex.EncodeToString(sum[:])
+		fake.files[id] = b
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"path":  id,
+			"md5":   hex.EncodeToString(sum[:]),
+			"size":  len(b),
+			"mtime": 1600000000,
+		})
+	case "/group1/delete":
+		delete(fake.files, r.FormValue("path"))
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	default:
+		b, ok := fake.files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(b)
+	}
+}
+
+func TestFastdfsStorage(t *testing.T) {
+	fake := &fakeFastdfs{files: make(map[string][]byte)}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	index := filepath.Join(t.TempDir(), "index.json")
+	store, err := NewFastdfs(srv.URL, "token", FastdfsIndexFile(index), FastdfsWebPrefix("http://cdn.example.com"))
+	assert.NoError(t, err)
+
+	assert.NoError(t, store.Put("/hello.txt", []byte("hello world")))
+	assert.NoError(t, store.Put("copy.txt", []byte("hello world")))
+	assert.NoError(t, store.Put("images/a.png", []byte("png")))
+	assert.Len(t, fake.files, 2)
+
+	content, err := store.Get("hello.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world", string(content))
+
+	objects, err := store.List("images/")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"images/a.png"}, names(objects))
+	assert.Equal(t, int64(3), objects[0].Size())
+
+	web, err := store.WebURL("images/a.png")
+	assert.NoError(t, err)
+	assert.Regexp(t, `^http://cdn.example.com/group1/default/[0-9a-f]+$`, web)
+	assert.Equal(t, web, store.BucketURI("images/a.png").String())
+
+	// 索引持久化后可以被新的实例加载
+	reopened, err := NewFastdfs(srv.URL, "token", FastdfsIndexFile(index))
+	assert.NoError(t, err)
+	assert.True(t, reopened.Exist("images/a.png"))
+
+	assert.NoError(t, store.Move("images/b.png", "images/a.png"))
+	assert.False(t, store.Exist("images/a.png"))
+	content, err = store.Get("images/b.png")
+	assert.NoError(t, err)
+	assert.Equal(t, "png", string(content))
+
+	// 内容相同的 key 共享一个文件, 全部删除后才删除远端文件
+	assert.NoError(t, store.Remove("hello.txt"))
+	assert.Len(t, fake.files, 2)
+	content, err = store.Get("copy.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world", string(content))
+	assert.NoError(t, store.Remove("copy.txt"))
+	assert.Len(t, fake.files, 1)
+
+	_, err = store.Get("hello.txt")
+	assert.True(t, errors.Is(err, ErrNotExist))
+	_, err = store.Stat("copy.txt")
+	assert.True(t, errors.Is(err, ErrNotExist))
+}
+
+func TestFastdfsStorage_Token(t *testing.T) {
+	srv := httptest.NewServer(&fakeFastdfs{files: make(map[string][]byte)})
+	defer srv.Close()
+
+	store, err := NewFastdfs(srv.URL, "wrong", FastdfsWithIndex(NewFastdfsMemoryIndex()))
+	assert.NoError(t, err)
+
+	err = store.Put("hello.txt", []byte("hello world"))
+	assert.True(t, errors.Is(err, ErrPermission))
+	assert.False(t, store.Exist("hello.txt"))
+}
+
+func TestFastdfsStorage_release(t *testing.T) {
+	fake := &fakeFastdfs{files: make(map[string][]byte)}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	// 没有指定 Index 时不会退回到内存
+	_, err := NewFastdfs(srv.URL, "token", FastdfsRegistry(NewRegistry()))
+	assert.True(t, errors.Is(err, ErrInvalid))
+
+	store, err := NewFastdfs(srv.URL, "token", FastdfsWithIndex(NewFastdfsMemoryIndex()), FastdfsRegistry(NewRegistry()))
+	assert.NoError(t, err)
+
+	// 删除与上传相同内容并发进行时, 新的 key 引用的文件不会被删除
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		assert.NoError(t, store.Put("old.txt", []byte("same")))
+
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, store.Remove("old.txt"))
+		}()
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, store.Put("new.txt", []byte("same")))
+		}()
+		wg.Wait()
+
+		content, err := store.Get("new.txt")
+		assert.NoError(t, err)
+		assert.Equal(t, "same", string(content))
+		assert.NoError(t, store.Remove("new.txt"))
+	}
+	assert.Len(t, fake.files, 0)
+	assert.Equal(t, 0, store.Index.Refs("/group1/default/"+fmt.Sprintf("%x", md5.Sum([]byte("same")))))
+}
@@ -5,9 +5,11 @@ go 1.19
 require (
 	github.com/aws/aws-sdk-go v1.44.194
 	github.com/hysios/log v0.0.1
+	github.com/klauspost/compress v1.16.7
 	github.com/minio/minio-go v6.0.14+incompatible
 	github.com/qiniu/go-sdk/v7 v7.14.0
 	github.com/stretchr/testify v1.8.1
+	golang.org/x/sync v0.0.0-20220722155255-886fb9371eb4
 )
 
 require (
@@ -43,7 +45,6 @@ require (
 	go.uber.org/zap v1.19.1 // indirect
 	golang.org/x/crypto v0.0.0-20210921155107-089bfa567519 // indirect
 	golang.org/x/net v0.5.0 // indirect
-	golang.org/x/sync v0.0.0-20220722155255-886fb9371eb4 // indirect
 	golang.org/x/sys v0.4.0 // indirect
 	golang.org/x/text v0.6.0 // indirect
 	google.golang.org/protobuf v1.28.0 // indirect
@@ -0,0 +1,199 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sort"
+	"strings"
+)
+
+// listPageSize 每页请求的最大对象数量
+const listPageSize = 1000
+
+// SkipAll 在 WalkFunc 中返回, 表示停止遍历且 Walk 不返回错误
+var SkipAll = errors.New("storage: skip all")
+
+// ListOptions 列举对象的选项
+//
+// Recursive 为 true 时列出前缀下的所有对象, 忽略 Delimiter; 否则按 Delimiter
+// (默认为 "/") 分组, 分组的公共前缀作为目录返回. Limit 为最多返回的条数, 0 不限制
+type ListOptions struct {
+	Prefix     string
+	Delimiter  string
+	StartAfter string
+	Limit      int
+	Recursive  bool
+}
+
+func (opts ListOptions) delimiter() string {
+	if opts.Recursive {
+		return ""
+	}
+	if opts.Delimiter == "" {
+		return "/"
+	}
+	return opts.Delimiter
+}
+
+func (opts ListOptions) pageSize() int {
+	if opts.Limit > 0 && opts.Limit < listPageSize {
+		return opts.Limit
+	}
+	return listPageSize
+}
+
+// Lister 支持分页惰性列举对象的存储
+type Lister interface {
+	ListObjects(ctx context.Context, opts ListOptions) *ObjectIterator
+}
+
+// WalkFunc 遍历对象时的回调, 返回 SkipAll 停止遍历
+type WalkFunc func(info os.FileInfo) error
+
+// listPageFunc 获取 token 对应的一页对象, 返回下一页的 token, 为空表示没有更多数据
+type listPageFunc func(ctx context.Context, token string) (page []os.FileInfo, next string, err error)
+
+// ObjectIterator 对象迭代器, 在 Next 时才按页请求后端
+//
+//	it := store.ListObjects(ctx, storage.ListOptions{Prefix: "images/"})
+//	for it.Next() {
+//		info := it.Object()
+//	}
+//	if err := it.Err(); err != nil {
+//		return err
+//	}
+type ObjectIterator struct {
+	ctx   context.Context
+	fetch listPageFunc
+	limit int
+
+	page    []os.FileInfo
+	token   string
+	started bool
+	count   int
+	cur     os.FileInfo
+	err     error
+}
+
+func newObjectIterator(ctx context.Context, opts ListOptions, fetch listPageFunc) *ObjectIterator {
+	return &ObjectIterator{ctx: ctx, fetch: fetch, limit: opts.Limit}
+}
+
+// Next 前进到下一个对象, 没有更多对象或出错时返回 false
+func (it *ObjectIterator) Next() bool {
+	if it.err != nil || (it.limit > 0 && it.count >= it.limit) {
+		return false
+	}
+
+	for len(it.page) == 0 {
+		if it.started && it.token == "" {
+			return false
+		}
+
+		if err := it.ctx.Err(); err != nil {
+			it.err = err
+			return false
+		}
+
+		page, next, err := it.fetch(it.ctx, it.token)
+		if err != nil {
+			it.err = err
+			return false
+		}
+
+		it.started = true
+		it.page, it.token = page, next
+	}
+
+	it.cur, it.page = it.page[0], it.page[1:]
+	it.count++
+	return true
+}
+
+// Object 返回当前的对象
+func (it *ObjectIterator) Object() os.FileInfo {
+	return it.cur
+}
+
+// Err 返回迭代过程中的错误
+func (it *ObjectIterator) Err() error {
+	return it.err
+}
+
+// Iterate 返回 store 的对象迭代器, store 未实现 Lister 时使用 List 的结果模拟
+func Iterate(ctx context.Context, store Storage, opts ListOptions) *ObjectIterator {
+	if lister, ok := store.(Lister); ok {
+		return lister.ListObjects(ctx, opts)
+	}
+
+	return newObjectIterator(ctx, opts, func(ctx context.Context, token string) ([]os.FileInfo, string, error) {
+		objects, err := AdaptContext(store).ListContext(ctx, opts.Prefix)
+		if err != nil {
+			return nil, "", err
+		}
+		return groupObjects(objects, opts), "", nil
+	})
+}
+
+// Walk 按顺序遍历 store 中符合 opts 的对象
+func Walk(ctx context.Context, store Storage, opts ListOptions, fn WalkFunc) error {
+	it := Iterate(ctx, store, opts)
+	for it.Next() {
+		if err := fn(it.Object()); err != nil {
+			if err == SkipAll {
+				return nil
+			}
+			return err
+		}
+	}
+	return it.Err()
+}
+
+// groupObjects 对完整的对象列表应用 StartAfter 与 Delimiter, 并按 key 排序
+func groupObjects(objects []os.FileInfo, opts ListOptions) []os.FileInfo {
+	var (
+		delimiter = opts.delimiter()
+		prefixes  = make(map[string]bool)
+		result    = make([]os.FileInfo, 0, len(objects))
+	)
+
+	for _, obj := range objects {
+		key := obj.Name()
+		if !strings.HasPrefix(key, opts.Prefix) || key <= opts.StartAfter {
+			continue
+		}
+
+		if delimiter != "" {
+			rest := key[len(opts.Prefix):]
+			if i := strings.Index(rest, delimiter); i >= 0 {
+				dir := opts.Prefix + rest[:i+len(delimiter)]
+				if !prefixes[dir] && dir > opts.StartAfter {
+					prefixes[dir] = true
+					result = append(result, &ObjectInfo{key: dir, isDir: true})
+				}
+				continue
+			}
+		}
+
+		result = append(result, obj)
+	}
+
+	sortObjects(result)
+	return result
+}
+
+// mergePage 合并一页中的对象与公共前缀, 公共前缀作为目录返回
+func mergePage(objects []os.FileInfo, prefixes []string) []os.FileInfo {
+	for _, prefix := range prefixes {
+		objects = append(objects, &ObjectInfo{key: prefix, isDir: true})
+	}
+	sortObjects(objects)
+	return objects
+}
+
+func sortObjects(objects []os.FileInfo) {
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Name() < objects[j].Name()
+	})
+}
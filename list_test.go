@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func names(objects []os.FileInfo) []string {
+	var result = make([]string, 0, len(objects))
+	for _, obj := range objects {
+		result = append(result, obj.Name())
+	}
+	return result
+}
+
+func TestGroupObjects(t *testing.T) {
+	objects := []os.FileInfo{
+		&ObjectInfo{key: "a/1.txt"},
+		&ObjectInfo{key: "a/b/2.txt"},
+		&ObjectInfo{key: "a/b/3.txt"},
+		&ObjectInfo{key: "a/c/4.txt"},
+		&ObjectInfo{key: "b/5.txt"},
+	}
+
+	got := groupObjects(objects, ListOptions{Prefix: "a/"})
+	assert.Equal(t, []string{"a/1.txt", "a/b/", "a/c/"}, names(got))
+	assert.True(t, got[1].IsDir())
+
+	got = groupObjects(objects, ListOptions{Prefix: "a/", Recursive: true, StartAfter: "a/b/2.txt"})
+	assert.Equal(t, []string{"a/b/3.txt", "a/c/4.txt"}, names(got))
+}
+
+func TestObjectIterator(t *testing.T) {
+	var calls int
+	fetch := func(ctx context.Context, token string) ([]os.FileInfo, string, error) {
+		calls++
+		page, _ := strconv.Atoi(token)
+		objects := []os.FileInfo{
+			&ObjectInfo{key: strconv.Itoa(page*2 + 0)},
+			&ObjectInfo{key: strconv.Itoa(page*2 + 1)},
+		}
+		if page == 2 {
+			return objects, "", nil
+		}
+		return objects, strconv.Itoa(page + 1), nil
+	}
+
+	it := newObjectIterator(context.Background(), ListOptions{}, fetch)
+	var keys []string
+	for it.Next() {
+		keys = append(keys, it.Object().Name())
+	}
+	assert.NoError(t, it.Err())
+	assert.Equal(t, []string{"0", "1", "2", "3", "4", "5"}, keys)
+	assert.Equal(t, 3, calls)
+
+	// Limit 之后不再请求后续的页
+	calls = 0
+	it = newObjectIterator(context.Background(), ListOptions{Limit: 3}, fetch)
+	keys = keys[:0]
+	for it.Next() {
+		keys = append(keys, it.Object().Name())
+	}
+	assert.Equal(t, []string{"0", "1", "2"}, keys)
+	assert.Equal(t, 2, calls)
+}
+
+func TestObjectIterator_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	it := newObjectIterator(ctx, ListOptions{}, func(ctx context.Context, token string) ([]os.FileInfo, string, error) {
+		t.Fatal("must not fetch after cancel")
+		return nil, "", nil
+	})
+	assert.False(t, it.Next())
+	assert.ErrorIs(t, it.Err(), context.Canceled)
+}
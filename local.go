@@ -0,0 +1,340 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// localTempPrefix 写入过程中的临时文件前缀, List 时会被忽略
+const localTempPrefix = ".storage-tmp-"
+
+// LocalStorage 本地文件系统存储, 以 Root 目录作为存储空间, 适用于开发与 CI 环境
+type LocalStorage struct {
+	Root       string
+	Bucket     string
+	HttpPrefix string
+
+	registry *Registry
+}
+
+type LocalOptionFunc func(*LocalStorage) error
+
+// LocalWebPrefix 设置对外访问的 http 前缀
+func LocalWebPrefix(url string) LocalOptionFunc {
+	return func(local *LocalStorage) error {
+		local.HttpPrefix = url
+		return nil
+	}
+}
+
+// LocalBucket 设置存储空间名称, 默认为 Root 目录名
+func LocalBucket(bucket string) LocalOptionFunc {
+	return func(local *LocalStorage) error {
+		local.Bucket = bucket
+		return nil
+	}
+}
+
+// LocalRegistry 注册到指定的注册表, 默认为 DefaultRegistry
+func LocalRegistry(registry *Registry) LocalOptionFunc {
+	return func(local *LocalStorage) error {
+		local.registry = registry
+		return nil
+	}
+}
+
+// NewLocal 创建以 root 为根目录的本地存储, 目录不存在时自动创建
+func NewLocal(root string, opts ...LocalOptionFunc) (store *LocalStorage, err error) {
+	root, err = filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+
+	store = &LocalStorage{
+		Root:   root,
+		Bucket: filepath.Base(root),
+	}
+
+	for _, opt := range opts {
+		if err = opt(store); err != nil {
+			return nil, err
+		}
+	}
+
+	register(store.registry, "file", store, store.Hostname())
+
+	return store, nil
+}
+
+func (store *LocalStorage) Hostname() string {
+	return hostname(store.HttpPrefix)
+}
+
+// filename 将 key 转换为 Root 下的文件路径, 不会越出 Root 目录
+func (store *LocalStorage) filename(key string) string {
+	return filepath.Join(store.Root, filepath.FromSlash(path.Clean("/"+key)))
+}
+
+// List 列出前缀为 prefix 的文件, 不包括目录
+func (store *LocalStorage) List(prefix string) ([]os.FileInfo, error) {
+	prefix = strings.TrimPrefix(prefix, "/")
+
+	var (
+		result = make([]os.FileInfo, 0)
+		dir    = store.filename(prefix[:strings.LastIndex(prefix, "/")+1])
+	)
+
+	err := filepath.Walk(dir, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+
+		if info.IsDir() || strings.HasPrefix(info.Name(), localTempPrefix) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(store.Root, name)
+		if err != nil {
+			return err
+		}
+
+		key := filepath.ToSlash(rel)
+		if strings.HasPrefix(key, prefix) {
+			result = append(result, store.objectInfo(key, info))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, newError("list", prefix, nil, err)
+	}
+	return result, nil
+}
+
+func (store *LocalStorage) Get(key string) ([]byte, error) {
+	b, err := ioutil.ReadFile(store.filename(key))
+	if err != nil {
+		return nil, newError("get", key, nil, err)
+	}
+	return b, nil
+}
+
+func (store *LocalStorage) Open(key string) (io.ReadCloser, error) {
+	f, err := os.Open(store.filename(key))
+	if err != nil {
+		return nil, newError("open", key, nil, err)
+	}
+	return f, nil
+}
+
+func (store *LocalStorage) GetRange(key string, offset, length int64) ([]byte, error) {
+	return getRange(store, key, offset, length)
+}
+
+// OpenRange 打开文件并定位到 offset
+func (store *LocalStorage) OpenRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	if err := checkRange(key, offset); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(store.filename(key))
+	if err != nil {
+		return nil, newError("open", key, nil, err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, newError("open", key, nil, err)
+	}
+
+	if offset > info.Size() {
+		f.Close()
+		return nil, newError("open", key, ErrInvalid, fmt.Errorf("offset %d out of range", offset))
+	}
+
+	if _, err = f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, newError("open", key, nil, err)
+	}
+	return limitBody(f, length), nil
+}
+
+// PutFile 复制本地文件到存储中
+func (store *LocalStorage) PutFile(key string, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return newError("put", key, nil, err)
+	}
+	defer f.Close()
+
+	return store.PutReader(key, f, -1)
+}
+
+func (store *LocalStorage) Put(key string, val []byte) error {
+	return store.PutReader(key, bytes.NewReader(val), int64(len(val)))
+}
+
+// PutReader 先写入同目录下的临时文件再重命名, 保证读取者不会看到写了一半的文件
+func (store *LocalStorage) PutReader(key string, r io.Reader, size int64) error {
+	var name = store.filename(key)
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return newError("put", key, nil, err)
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(name), localTempPrefix+"*")
+	if err != nil {
+		return newError("put", key, nil, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return newError("put", key, nil, err)
+	}
+
+	if err = tmp.Close(); err != nil {
+		return newError("put", key, nil, err)
+	}
+
+	if err = os.Chmod(tmp.Name(), 0644); err != nil {
+		return newError("put", key, nil, err)
+	}
+
+	if err = os.Rename(tmp.Name(), name); err != nil {
+		return newError("put", key, nil, err)
+	}
+	return nil
+}
+
+// PutObject 本地文件没有元数据, 忽略 opts, Stat 时根据扩展名推断 Content-Type
+func (store *LocalStorage) PutObject(key string, r io.Reader, size int64, opts PutOptions) error {
+	return store.PutObjectContext(context.Background(), key, r, size, opts)
+}
+
+func (store *LocalStorage) PutObjectContext(ctx context.Context, key string, r io.Reader, size int64, opts PutOptions) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return store.PutReader(key, r, size)
+}
+
+// Move 通过重命名移动文件
+func (store *LocalStorage) Move(dest string, from string) error {
+	var name = store.filename(dest)
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return newError("move", dest, nil, err)
+	}
+
+	if err := os.Rename(store.filename(from), name); err != nil {
+		return newError("move", from, nil, err)
+	}
+	return nil
+}
+
+func (store *LocalStorage) Copy(dest string, from string, opts ...CopyOptionFunc) error {
+	return store.CopyContext(context.Background(), dest, from, opts...)
+}
+
+// CopyContext 复制文件, 本地文件没有元数据, 不支持替换元数据
+func (store *LocalStorage) CopyContext(ctx context.Context, dest string, from string, opts ...CopyOptionFunc) error {
+	var copts = newCopyOptions(store.Bucket, opts)
+	if copts.SourceBucket != store.Bucket || copts.replace() {
+		return newError("copy", from, ErrNotImplemented, nil)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	f, err := os.Open(store.filename(from))
+	if err != nil {
+		return newError("copy", from, nil, err)
+	}
+	defer f.Close()
+
+	return store.PutReader(dest, f, -1)
+}
+
+// Remove 删除文件, 文件不存在时不返回错误
+func (store *LocalStorage) Remove(key string) error {
+	err := os.Remove(store.filename(key))
+	if err != nil && !os.IsNotExist(err) {
+		return newError("remove", key, nil, err)
+	}
+	return nil
+}
+
+func (store *LocalStorage) Exist(key string) bool {
+	info, err := os.Stat(store.filename(key))
+	if err != nil {
+		return false
+	}
+	return !info.IsDir()
+}
+
+func (store *LocalStorage) Stat(key string) (os.FileInfo, error) {
+	info, err := os.Stat(store.filename(key))
+	if err != nil {
+		return nil, newError("stat", key, nil, err)
+	}
+	return store.objectInfo(key, info), nil
+}
+
+func (store *LocalStorage) objectInfo(key string, info os.FileInfo) *ObjectInfo {
+	return &ObjectInfo{
+		key:   key,
+		size:  info.Size(),
+		time:  info.ModTime(),
+		isDir: info.IsDir(),
+		meta: &ObjectMeta{
+			ContentType: mime.TypeByExtension(path.Ext(key)),
+		},
+	}
+}
+
+// WebURL 返回文件的访问地址, 没有设置 HttpPrefix 时返回 file:// 地址
+func (store *LocalStorage) WebURL(key string) (string, error) {
+	if Empty(store.HttpPrefix) {
+		u := &url.URL{Scheme: "file", Path: filepath.ToSlash(store.filename(key))}
+		return u.String(), nil
+	}
+
+	u, err := url.Parse(store.HttpPrefix)
+	if err != nil {
+		return "", err
+	}
+
+	u.Path = path.Join(u.Path, key)
+	return u.String(), nil
+}
+
+func (store *LocalStorage) BucketName() string {
+	return store.Bucket
+}
+
+func (store *LocalStorage) BucketURI(key string) BucketURI {
+	return BucketURI(fmt.Sprintf("%s://%s/%s", "file", store.Bucket, key))
+}
+
+var (
+	_ Storage     = &LocalStorage{}
+	_ RangeReader = &LocalStorage{}
+	_ Copier      = &LocalStorage{}
+	_ Putter      = &LocalStorage{}
+)
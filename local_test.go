@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalStorage(t *testing.T) {
+	store, err := NewLocal(t.TempDir(), LocalBucket("local"), LocalWebPrefix("http://static.local/files"))
+	assert.NoError(t, err)
+
+	assert.NoError(t, store.Put("/images/a.png", []byte("png")))
+	assert.NoError(t, store.Put("images/b/c.txt", []byte("hello world")))
+	assert.NoError(t, store.Put("docs/d.txt", []byte("doc")))
+
+	content, err := store.Get("images/a.png")
+	assert.NoError(t, err)
+	assert.Equal(t, "png", string(content))
+
+	objects, err := store.List("images/")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"images/a.png", "images/b/c.txt"}, names(objects))
+
+	info, err := store.Stat("images/a.png")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), info.Size())
+	assert.Equal(t, "image/png", MetaOf(info).ContentType)
+
+	assert.NoError(t, store.Move("docs/e.txt", "docs/d.txt"))
+	assert.True(t, store.Exist("docs/e.txt"))
+	assert.False(t, store.Exist("docs/d.txt"))
+
+	assert.NoError(t, store.Remove("docs/e.txt"))
+	assert.NoError(t, store.Remove("docs/e.txt"))
+	_, err = store.Get("docs/e.txt")
+	assert.True(t, errors.Is(err, ErrNotExist))
+
+	url, err := store.WebURL("images/a.png")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://static.local/files/images/a.png", url)
+
+	assert.Equal(t, url, store.BucketURI("images/a.png").String())
+}
+
+func TestLocalStorage_PathTraversal(t *testing.T) {
+	var dir = t.TempDir()
+	store, err := NewLocal(filepath.Join(dir, "root"))
+	assert.NoError(t, err)
+
+	assert.NoError(t, store.Put("../../escape.txt", []byte("x")))
+	_, err = os.Stat(filepath.Join(dir, "escape.txt"))
+	assert.True(t, os.IsNotExist(err))
+	assert.True(t, store.Exist("escape.txt"))
+}
+
+func TestLocalStorage_PutFile(t *testing.T) {
+	store, err := NewLocal(t.TempDir())
+	assert.NoError(t, err)
+
+	var src = filepath.Join(t.TempDir(), "src.txt")
+	assert.NoError(t, ioutil.WriteFile(src, []byte("hello"), 0644))
+	assert.NoError(t, store.PutFile("a/src.txt", src))
+
+	entries, err := ioutil.ReadDir(filepath.Join(store.Root, "a"))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1, "temp files must be renamed")
+}
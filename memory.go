@@ -0,0 +1,321 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStorage 线程安全的内存存储, 用于单元测试, 不需要任何网络服务
+//
+// 与对象存储相同, 以 / 结尾的 key 为目录标记
+type MemoryStorage struct {
+	Bucket     string
+	HttpPrefix string
+
+	mu       sync.RWMutex
+	objects  map[string]*memoryObject
+	registry *Registry
+}
+
+// memoryObject 写入后不会被修改, 可以在读取时共享 data
+type memoryObject struct {
+	data []byte
+	time time.Time
+	meta ObjectMeta
+}
+
+type MemoryOptionFunc func(*MemoryStorage) error
+
+// MemoryWebPrefix 设置对外访问的 http 前缀
+func MemoryWebPrefix(url string) MemoryOptionFunc {
+	return func(mem *MemoryStorage) error {
+		mem.HttpPrefix = url
+		return nil
+	}
+}
+
+// MemoryRegistry 注册到指定的注册表, 默认为 DefaultRegistry
+func MemoryRegistry(registry *Registry) MemoryOptionFunc {
+	return func(mem *MemoryStorage) error {
+		mem.registry = registry
+		return nil
+	}
+}
+
+func NewMemory(bucket string, opts ...MemoryOptionFunc) (store *MemoryStorage, err error) {
+	store = &MemoryStorage{
+		Bucket:  bucket,
+		objects: make(map[string]*memoryObject),
+	}
+
+	for _, opt := range opts {
+		if err = opt(store); err != nil {
+			return nil, err
+		}
+	}
+
+	register(store.registry, "mem", store, store.Hostname())
+
+	return store, nil
+}
+
+func (store *MemoryStorage) Hostname() string {
+	return hostname(store.HttpPrefix)
+}
+
+func (store *MemoryStorage) load(key string) (*memoryObject, bool) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	obj, ok := store.objects[strings.TrimPrefix(key, "/")]
+	return obj, ok
+}
+
+func (store *MemoryStorage) List(prefix string) ([]os.FileInfo, error) {
+	prefix = strings.TrimPrefix(prefix, "/")
+
+	store.mu.RLock()
+	var result = make([]os.FileInfo, 0)
+	for key, obj := range store.objects {
+		if strings.HasPrefix(key, prefix) {
+			result = append(result, obj.info(key))
+		}
+	}
+	store.mu.RUnlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name() < result[j].Name()
+	})
+	return result, nil
+}
+
+func (store *MemoryStorage) Get(key string) ([]byte, error) {
+	obj, ok := store.load(key)
+	if !ok {
+		return nil, newError("get", key, ErrNotExist, nil)
+	}
+	return append([]byte(nil), obj.data...), nil
+}
+
+func (store *MemoryStorage) Open(key string) (io.ReadCloser, error) {
+	obj, ok := store.load(key)
+	if !ok {
+		return nil, newError("open", key, ErrNotExist, nil)
+	}
+	return ioutil.NopCloser(bytes.NewReader(obj.data)), nil
+}
+
+func (store *MemoryStorage) GetRange(key string, offset, length int64) ([]byte, error) {
+	return getRange(store, key, offset, length)
+}
+
+func (store *MemoryStorage) OpenRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	if err := checkRange(key, offset); err != nil {
+		return nil, err
+	}
+
+	obj, ok := store.load(key)
+	if !ok {
+		return nil, newError("open", key, ErrNotExist, nil)
+	}
+
+	var size = int64(len(obj.data))
+	if offset > size {
+		return nil, newError("open", key, ErrInvalid, fmt.Errorf("offset %d out of range", offset))
+	}
+
+	var end = size
+	if length >= 0 && offset+length < size {
+		end = offset + length
+	}
+	return ioutil.NopCloser(bytes.NewReader(obj.data[offset:end])), nil
+}
+
+func (store *MemoryStorage) PutFile(key string, file string) error {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return newError("put", key, nil, err)
+	}
+	return store.Put(key, b)
+}
+
+func (store *MemoryStorage) Put(key string, val []byte) error {
+	return store.PutObject(key, bytes.NewReader(val), int64(len(val)), PutOptions{})
+}
+
+func (store *MemoryStorage) PutReader(key string, r io.Reader, size int64) error {
+	return store.PutObject(key, r, size, PutOptions{})
+}
+
+// PutObject 保存 PutOptions 中的所有元数据, Stat 时原样返回
+func (store *MemoryStorage) PutObject(key string, r io.Reader, size int64, opts PutOptions) error {
+	return store.PutObjectContext(context.Background(), key, r, size, opts)
+}
+
+func (store *MemoryStorage) PutObjectContext(ctx context.Context, key string, r io.Reader, size int64, opts PutOptions) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r, err := opts.detect(key, r)
+	if err != nil {
+		return err
+	}
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return newError("put", key, nil, err)
+	}
+	return store.store(key, b, opts.meta())
+}
+
+func (store *MemoryStorage) store(key string, data []byte, meta ObjectMeta) error {
+	key = strings.TrimPrefix(key, "/")
+	sum := md5.Sum(data)
+	meta.ETag = hex.EncodeToString(sum[:])
+
+	obj := &memoryObject{
+		data: data,
+		time: time.Now(),
+		meta: meta,
+	}
+
+	store.mu.Lock()
+	store.objects[key] = obj
+	store.mu.Unlock()
+	return nil
+}
+
+func (store *MemoryStorage) Move(dest string, from string) error {
+	dest = strings.TrimPrefix(dest, "/")
+	from = strings.TrimPrefix(from, "/")
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	obj, ok := store.objects[from]
+	if !ok {
+		return newError("move", from, ErrNotExist, nil)
+	}
+
+	delete(store.objects, from)
+	store.objects[dest] = obj
+	return nil
+}
+
+func (store *MemoryStorage) Copy(dest string, from string, opts ...CopyOptionFunc) error {
+	return store.CopyContext(context.Background(), dest, from, opts...)
+}
+
+// CopyContext 复制对象, 与源对象共享数据, 替换元数据时只修改副本
+func (store *MemoryStorage) CopyContext(ctx context.Context, dest string, from string, opts ...CopyOptionFunc) error {
+	var copts = newCopyOptions(store.Bucket, opts)
+	if copts.SourceBucket != store.Bucket {
+		return newError("copy", from, ErrNotImplemented, nil)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	dest = strings.TrimPrefix(dest, "/")
+	from = strings.TrimPrefix(from, "/")
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	obj, ok := store.objects[from]
+	if !ok {
+		return newError("copy", from, ErrNotExist, nil)
+	}
+
+	var copied = &memoryObject{data: obj.data, time: time.Now(), meta: obj.meta}
+	copied.meta.Metadata = cloneMetadata(obj.meta.Metadata)
+	if copts.Metadata != nil {
+		copied.meta.Metadata = cloneMetadata(copts.Metadata)
+	}
+	if copts.ContentType != "" {
+		copied.meta.ContentType = copts.ContentType
+	}
+
+	store.objects[dest] = copied
+	return nil
+}
+
+// Remove 删除对象, 对象不存在时不返回错误
+func (store *MemoryStorage) Remove(key string) error {
+	store.mu.Lock()
+	delete(store.objects, strings.TrimPrefix(key, "/"))
+	store.mu.Unlock()
+	return nil
+}
+
+func (store *MemoryStorage) Exist(key string) bool {
+	_, ok := store.load(key)
+	return ok
+}
+
+func (store *MemoryStorage) Stat(key string) (os.FileInfo, error) {
+	obj, ok := store.load(key)
+	if !ok {
+		return nil, newError("stat", key, ErrNotExist, nil)
+	}
+	return obj.info(strings.TrimPrefix(key, "/")), nil
+}
+
+// info 返回的元数据是副本, 调用者修改时不影响保存的对象
+func (obj *memoryObject) info(key string) *ObjectInfo {
+	var meta = obj.meta
+	meta.Metadata = cloneMetadata(obj.meta.Metadata)
+	return &ObjectInfo{
+		key:   key,
+		size:  int64(len(obj.data)),
+		time:  obj.time,
+		isDir: strings.HasSuffix(key, "/"),
+		meta:  &meta,
+	}
+}
+
+func (store *MemoryStorage) WebURL(key string) (string, error) {
+	if Empty(store.HttpPrefix) {
+		return string(store.BucketURI(key)), nil
+	}
+
+	u, err := url.Parse(store.HttpPrefix)
+	if err != nil {
+		return "", err
+	}
+
+	u.Path = path.Join(u.Path, key)
+	return u.String(), nil
+}
+
+func (store *MemoryStorage) BucketName() string {
+	return store.Bucket
+}
+
+func (store *MemoryStorage) BucketURI(key string) BucketURI {
+	return BucketURI(fmt.Sprintf("%s://%s/%s", "mem", store.Bucket, key))
+}
+
+// keepsMetadata Stat 返回上传时的 Content-Encoding 与用户元数据
+func (store *MemoryStorage) keepsMetadata() {}
+
+var (
+	_ Storage     = &MemoryStorage{}
+	_ RangeReader = &MemoryStorage{}
+	_ Copier      = &MemoryStorage{}
+	_ Putter      = &MemoryStorage{}
+)
@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"errors"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStorage(t *testing.T) {
+	store, err := NewMemory("test")
+	assert.NoError(t, err)
+
+	assert.NoError(t, store.Put("/hello.txt", []byte("hello world")))
+	assert.NoError(t, store.Put("images/", nil))
+	assert.NoError(t, store.Put("images/a.png", []byte("png")))
+
+	content, err := store.Get("hello.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world", string(content))
+
+	rd, err := store.Open("/hello.txt")
+	assert.NoError(t, err)
+	content, err = ioutil.ReadAll(rd)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world", string(content))
+
+	objects, err := store.List("images/")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"images/", "images/a.png"}, names(objects))
+	assert.True(t, objects[0].IsDir())
+	assert.False(t, objects[1].IsDir())
+
+	info, err := store.Stat("images/a.png")
+	assert.NoError(t, err)
+	assert.Equal(t, "image/png", MetaOf(info).ContentType)
+	assert.False(t, info.ModTime().IsZero())
+
+	assert.NoError(t, store.Move("hello2.txt", "hello.txt"))
+	assert.True(t, store.Exist("hello2.txt"))
+	assert.False(t, store.Exist("hello.txt"))
+	assert.True(t, errors.Is(store.Move("hello3.txt", "hello.txt"), ErrNotExist))
+
+	assert.NoError(t, store.Remove("hello2.txt"))
+	_, err = store.Get("hello2.txt")
+	assert.True(t, errors.Is(err, ErrNotExist))
+	_, err = store.Stat("hello2.txt")
+	assert.True(t, errors.Is(err, ErrNotExist))
+}
+
+func TestMemoryStorage_Concurrent(t *testing.T) {
+	store, err := NewMemory("test")
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := "k/" + strconv.Itoa(i)
+			assert.NoError(t, store.Put(key, []byte(key)))
+			_, err := store.Get(key)
+			assert.NoError(t, err)
+			_, err = store.List("k/")
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	objects, err := store.List("k/")
+	assert.NoError(t, err)
+	assert.Len(t, objects, 16)
+}
+
+func TestMemoryStorage_Metadata(t *testing.T) {
+	store, err := NewMemory("metadata", MemoryRegistry(NewRegistry()))
+	assert.NoError(t, err)
+
+	err = store.PutObject("a.txt", strings.NewReader("hello"), 5, PutOptions{Metadata: map[string]string{"owner": "alice"}})
+	assert.NoError(t, err)
+	assert.NoError(t, store.Copy("b.txt", "a.txt"))
+
+	// 修改 Stat 返回的元数据不影响保存的对象
+	info, err := store.Stat("a.txt")
+	assert.NoError(t, err)
+	MetaOf(info).Metadata["owner"] = "bob"
+
+	for _, key := range []string{"a.txt", "b.txt"} {
+		info, err = store.Stat(key)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"owner": "alice"}, MetaOf(info).Metadata, key)
+	}
+}
@@ -2,16 +2,21 @@ package storage
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net/http"
 	"net/url"
 	"os"
 	"path"
 	"strings"
+	"time"
 
 	"github.com/hysios/log"
 	"github.com/minio/minio-go"
 	"github.com/minio/minio-go/pkg/credentials"
+	"github.com/minio/minio-go/pkg/encrypt"
 )
 
 type MinioStorage struct {
@@ -22,8 +27,10 @@ type MinioStorage struct {
 	Bucket     string
 	HttpPrefix string
 	UseSSL     bool
+	Encryption *Encryption
 
-	client *minio.Client
+	client   *minio.Client
+	registry *Registry
 }
 
 func MinioWebPrefix(url string) MinioOptionFunc {
@@ -40,6 +47,14 @@ func MinioEndpoint(url string) MinioOptionFunc {
 	}
 }
 
+// MinioRegion 设置存储空间所在区域, 设置后生成签名地址时不需要请求 bucket location
+func MinioRegion(region string) MinioOptionFunc {
+	return func(minio *MinioStorage) error {
+		minio.Region = region
+		return nil
+	}
+}
+
 func MinioUseSSL(useSSL bool) MinioOptionFunc {
 	return func(minio *MinioStorage) error {
 		minio.UseSSL = useSSL
@@ -47,6 +62,22 @@ func MinioUseSSL(useSSL bool) MinioOptionFunc {
 	}
 }
 
+// MinioEncryption 默认的服务端加密, 可以通过 ContextWithEncryption 按次覆盖
+func MinioEncryption(enc *Encryption) MinioOptionFunc {
+	return func(minio *MinioStorage) error {
+		minio.Encryption = enc
+		return nil
+	}
+}
+
+// MinioRegistry 注册到指定的注册表, 默认为 DefaultRegistry
+func MinioRegistry(registry *Registry) MinioOptionFunc {
+	return func(minio *MinioStorage) error {
+		minio.registry = registry
+		return nil
+	}
+}
+
 type MinioOptionFunc func(*MinioStorage) error
 
 func NewMinio(appkey, secret string, bucket string, opts ...MinioOptionFunc) (store *MinioStorage, err error) {
@@ -57,18 +88,21 @@ func NewMinio(appkey, secret string, bucket string, opts ...MinioOptionFunc) (st
 		// client:    client,
 	}
 	for _, set := range opts {
-		set(store)
+		if err = set(store); err != nil {
+			return nil, err
+		}
 	}
 
 	log.Debugf("store %v %s %s", store, bucket, store.Hostname())
 
-	register("minio", store, store.Hostname())
-
-	client, err := minio.New(store.Endpoint, appkey, secret, store.UseSSL)
+	client, err := minio.NewWithRegion(store.Endpoint, appkey, secret, store.UseSSL, store.Region)
 	if err != nil {
 		return nil, err
 	}
 	store.client = client
+
+	// 客户端创建成功后再注册, 避免注册表中留下不可用的存储
+	register(store.registry, "minio", store, store.Hostname())
 	return store, nil
 }
 
@@ -92,7 +126,9 @@ func NewMinioV2(appkey, secret string, bucket string, opts ...MinioOptionFunc) (
 		// client:    client,
 	}
 	for _, set := range opts {
-		set(store)
+		if err = set(store); err != nil {
+			return nil, err
+		}
 	}
 
 	log.Debugf("store %v", store)
@@ -107,6 +143,10 @@ func NewMinioV2(appkey, secret string, bucket string, opts ...MinioOptionFunc) (
 }
 
 func (store *MinioStorage) List(prefix string) ([]os.FileInfo, error) {
+	return store.ListContext(context.Background(), prefix)
+}
+
+func (store *MinioStorage) ListContext(ctx context.Context, prefix string) ([]os.FileInfo, error) {
 	doneCh := make(chan struct{})
 
 	// Indicate to our routine to exit cleanly upon return.
@@ -115,93 +155,592 @@ func (store *MinioStorage) List(prefix string) ([]os.FileInfo, error) {
 	var result = make([]os.FileInfo, 0)
 	isRecursive := true
 	objectCh := store.client.ListObjectsV2(store.Bucket, prefix, isRecursive, doneCh)
-	for object := range objectCh {
-		if object.Err != nil {
-			fmt.Println(object.Err)
-			return nil, object.Err
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case object, ok := <-objectCh:
+			if !ok {
+				return result, nil
+			}
+			if object.Err != nil {
+				return nil, minioError("list", prefix, object.Err)
+			}
+
+			var obj = &ObjectInfo{key: object.Key, size: object.Size, time: object.LastModified}
+			if obj.key[len(obj.key)-1] == '/' {
+				obj.isDir = true
+			}
+
+			result = append(result, obj)
 		}
+	}
+}
+
+// ListObjects 使用 ListObjectsV2 按页惰性列举对象
+func (store *MinioStorage) ListObjects(ctx context.Context, opts ListOptions) *ObjectIterator {
+	core := minio.Core{Client: store.client}
 
-		var obj = &ObjectInfo{key: object.Key, size: object.Size, time: object.LastModified}
-		if obj.key[len(obj.key)-1] == '/' {
-			obj.isDir = true
+	return newObjectIterator(ctx, opts, func(ctx context.Context, token string) ([]os.FileInfo, string, error) {
+		result, err := core.ListObjectsV2(store.Bucket, opts.Prefix, token, false, opts.delimiter(), opts.pageSize(), opts.StartAfter)
+		if err != nil {
+			return nil, "", minioError("list", opts.Prefix, err)
 		}
 
-		result = append(result, obj)
-	}
-	return result, nil
+		var (
+			objects  = make([]os.FileInfo, 0, len(result.Contents)+len(result.CommonPrefixes))
+			prefixes = make([]string, 0, len(result.CommonPrefixes))
+			next     string
+		)
+		for _, object := range result.Contents {
+			objects = append(objects, minioObjectInfo(object))
+		}
+		for _, prefix := range result.CommonPrefixes {
+			prefixes = append(prefixes, prefix.Prefix)
+		}
+		if result.IsTruncated {
+			next = result.NextContinuationToken
+		}
+		return mergePage(objects, prefixes), next, nil
+	})
 }
 
 func (store *MinioStorage) Get(key string) ([]byte, error) {
-	object, err := store.client.GetObject(store.Bucket, key, minio.GetObjectOptions{})
-	key = strings.TrimPrefix(key, "/")
+	return store.GetContext(context.Background(), key)
+}
+
+func (store *MinioStorage) GetContext(ctx context.Context, key string) ([]byte, error) {
+	object, err := store.OpenContext(ctx, key)
 	if err != nil {
 		return nil, err
 	}
-	return ioutil.ReadAll(object)
+	defer object.Close()
+
+	b, err := ioutil.ReadAll(object)
+	if err != nil {
+		return nil, minioError("get", key, err)
+	}
+	return b, nil
 }
 
-func (store *MinioStorage) PutFile(key string, file string) error {
-	// 使用FPutObject上传一个zip文件。
-	key = strings.TrimPrefix(key, "/")
-	n, err := store.client.FPutObject(store.Bucket, key, file, minio.PutObjectOptions{})
+func (store *MinioStorage) Open(key string) (io.ReadCloser, error) {
+	return store.OpenContext(context.Background(), key)
+}
+
+// OpenContext 打开对象的读取流, 调用者需要负责关闭
+func (store *MinioStorage) OpenContext(ctx context.Context, key string) (io.ReadCloser, error) {
+	return store.OpenRange(ctx, key, 0, -1)
+}
+
+func (store *MinioStorage) GetRange(key string, offset, length int64) ([]byte, error) {
+	return getRange(store, key, offset, length)
+}
+
+// OpenRange 通过 Range 请求头读取对象的部分内容
+//
+// minio.Object 在 Stat 时会删除共享选项中的 Range, 因此使用 Core.GetObject
+// 直接发送带 Range 的请求, 同时也能立即返回对象不存在等错误
+func (store *MinioStorage) OpenRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	if err := checkRange(key, offset); err != nil {
+		return nil, err
+	}
+	if length == 0 {
+		return emptyBody(), nil
+	}
+
+	sse, err := store.sse(ctx, "open", key, nil, true)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	log.Debugf("Successfully uploaded %s of size %d\n", key, n)
-	return nil
+	var opts = minio.GetObjectOptions{ServerSideEncryption: sse}
+	if h := rangeHeader(offset, length); h != "" {
+		opts.Set("Range", h)
+	}
+
+	key = strings.TrimPrefix(key, "/")
+
+	type result struct {
+		body io.ReadCloser
+		err  error
+	}
+
+	// Core.GetObject 不支持 ctx, ctx 结束时放弃等待并关闭随后返回的连接
+	var (
+		core = minio.Core{Client: store.client}
+		ch   = make(chan result, 1)
+	)
+	go func() {
+		body, _, err := core.GetObject(store.Bucket, key, opts)
+		ch <- result{body, err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		go func() {
+			if r := <-ch; r.body != nil {
+				r.body.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	case r := <-ch:
+		if r.err != nil {
+			return nil, minioError("open", key, r.err)
+		}
+		return contextBody(ctx, r.body), nil
+	}
+}
+
+func (store *MinioStorage) PutFile(key string, file string) error {
+	return store.PutFileContext(context.Background(), key, file)
+}
+
+func (store *MinioStorage) PutFileContext(ctx context.Context, key string, file string) error {
+	return putFile(ctx, store, key, file)
 }
 
 func (store *MinioStorage) Put(key string, val []byte) error {
-	var buf = bytes.NewBuffer(val)
+	return store.PutContext(context.Background(), key, val)
+}
+
+func (store *MinioStorage) PutContext(ctx context.Context, key string, val []byte) error {
+	return store.PutReaderContext(ctx, key, bytes.NewReader(val), int64(len(val)))
+}
+
+func (store *MinioStorage) PutReader(key string, r io.Reader, size int64) error {
+	return store.PutReaderContext(context.Background(), key, r, size)
+}
+
+// PutReaderContext 以流的方式上传, size 为 -1 时由 minio 分片上传
+func (store *MinioStorage) PutReaderContext(ctx context.Context, key string, r io.Reader, size int64) error {
+	return store.PutObjectContext(ctx, key, r, size, PutOptions{})
+}
+
+func (store *MinioStorage) PutObject(key string, r io.Reader, size int64, opts PutOptions) error {
+	return store.PutObjectContext(context.Background(), key, r, size, opts)
+}
+
+// PutObjectContext 上传并设置元数据, 支持 PutOptions 的所有选项
+func (store *MinioStorage) PutObjectContext(ctx context.Context, key string, r io.Reader, size int64, opts PutOptions) error {
 	key = strings.TrimPrefix(key, "/")
-	n, err := store.client.PutObject(store.Bucket, key, buf, int64(len(val)), minio.PutObjectOptions{})
+	r, err := opts.detect(key, r)
 	if err != nil {
 		return err
 	}
+
+	sse, err := store.sse(ctx, "put", key, opts.Encryption, false)
+	if err != nil {
+		return err
+	}
+
+	n, err := store.client.PutObjectWithContext(ctx, store.Bucket, key, r, size, minio.PutObjectOptions{
+		ServerSideEncryption: sse,
+		ContentType:          opts.ContentType,
+		ContentDisposition:   opts.ContentDisposition,
+		CacheControl:         opts.CacheControl,
+		ContentEncoding:      opts.ContentEncoding,
+		UserMetadata:         opts.Metadata,
+		StorageClass:         opts.StorageClass,
+	})
+	if err != nil {
+		return minioError("put", key, err)
+	}
 	log.Debugf("Successfully uploaded %s of size %d\n", key, n)
 	return nil
 }
 
 func (store *MinioStorage) Move(dest string, from string) error {
-	srcOpts := minio.NewSourceInfo(store.Bucket, from, nil)
+	return store.MoveContext(context.Background(), dest, from)
+}
+
+// MoveContext 复制后删除源对象
+func (store *MinioStorage) MoveContext(ctx context.Context, dest string, from string) error {
+	if err := store.CopyContext(ctx, dest, from); err != nil {
+		return err
+	}
+	return store.RemoveContext(ctx, strings.TrimPrefix(from, "/"))
+}
+
+// minioMaxCopySize CopyObject 支持的最大对象, 更大的对象使用 ComposeObject 分片复制
+const minioMaxCopySize = 5 << 30
+
+// minioCopyHeaders 分片复制时需要从源对象带上的标准头部
+var minioCopyHeaders = []string{"Cache-Control", "Content-Disposition", "Content-Encoding", "Content-Language", "Expires"}
+
+func (store *MinioStorage) Copy(dest string, from string, opts ...CopyOptionFunc) error {
+	return store.CopyContext(context.Background(), dest, from, opts...)
+}
+
+// CopyContext 服务端复制, 大于 5GiB 的对象使用 ComposeObject 分片复制;
+// minio-go 的 CopyObject 不支持 context, 只在请求前检查 ctx
+func (store *MinioStorage) CopyContext(ctx context.Context, dest string, from string, opts ...CopyOptionFunc) error {
+	var copts = newCopyOptions(store.Bucket, opts)
 
 	dest = strings.TrimPrefix(dest, "/")
 	from = strings.TrimPrefix(from, "/")
 
-	dstOpts, err := minio.NewDestinationInfo(store.Bucket, dest, nil, nil)
+	dstSSE, err := store.sse(ctx, "copy", dest, nil, false)
 	if err != nil {
 		return err
 	}
-
-	err = store.client.CopyObject(dstOpts, srcOpts)
+	srcSSE, err := store.sse(ctx, "copy", from, copts.SourceEncryption, true)
 	if err != nil {
 		return err
 	}
 
-	return store.Remove(from)
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+
+	info, err := store.client.StatObject(copts.SourceBucket, from, minio.StatObjectOptions{
+		GetObjectOptions: minio.GetObjectOptions{ServerSideEncryption: srcSSE},
+	})
+	if err != nil {
+		return minioError("copy", from, err)
+	}
+
+	var meta map[string]string
+	switch {
+	case copts.replace():
+		meta = make(map[string]string, len(copts.Metadata)+2)
+		for k, v := range copts.Metadata {
+			meta[k] = v
+		}
+		// 替换元数据时没有指定的 Content-Type 会被重置, 沿用源对象的
+		var contentType = copts.ContentType
+		if contentType == "" {
+			contentType = info.ContentType
+		}
+		if contentType != "" {
+			meta["Content-Type"] = contentType
+		}
+		// minio-go 只在元数据不为空时发送 REPLACE, 这里显式指定, 空的 Metadata 也会清空源对象的元数据
+		meta["x-amz-metadata-directive"] = "REPLACE"
+	case info.Size > minioMaxCopySize:
+		// 分片复制时 minio-go 不会沿用源对象的元数据与标准头部
+		meta = make(map[string]string)
+		if info.ContentType != "" {
+			meta["Content-Type"] = info.ContentType
+		}
+		for k, v := range info.Metadata {
+			if strings.HasPrefix(k, "X-Amz-Meta-") && len(v) > 0 {
+				meta[k] = v[0]
+			}
+		}
+		for _, k := range minioCopyHeaders {
+			if v := info.Metadata.Get(k); v != "" {
+				meta[k] = v
+			}
+		}
+	}
+
+	srcOpts := minio.NewSourceInfo(copts.SourceBucket, from, srcSSE)
+	dstOpts, err := minio.NewDestinationInfo(store.Bucket, dest, dstSSE, meta)
+	if err != nil {
+		return minioError("copy", dest, err)
+	}
+
+	if info.Size > minioMaxCopySize {
+		err = store.client.ComposeObject(dstOpts, []minio.SourceInfo{srcOpts})
+	} else {
+		err = store.client.CopyObject(dstOpts, srcOpts)
+	}
+	if err != nil {
+		return minioError("copy", from, err)
+	}
+	return nil
+}
+
+// sameBackend 同一个 minio 服务与账号下的存储空间之间可以服务端复制
+func (store *MinioStorage) sameBackend(src Storage) bool {
+	other, ok := src.(*MinioStorage)
+	return ok && other.Endpoint == store.Endpoint && other.AccessKey == store.AccessKey
 }
 
 func (store *MinioStorage) Remove(key string) error {
+	return store.RemoveContext(context.Background(), key)
+}
+
+func (store *MinioStorage) RemoveContext(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	err := store.client.RemoveObject(store.Bucket, key)
 	if err != nil {
-		return err
+		return minioError("remove", key, err)
 	}
 	return nil
 }
 
+// RemoveMany 使用 RemoveObjects 批量删除, minio-go 每 1000 个 key 发送一次请求
+func (store *MinioStorage) RemoveMany(ctx context.Context, keys []string) ([]BatchResult, error) {
+	var (
+		objectsCh = make(chan string, len(keys))
+		errs      = make(map[string]error)
+	)
+
+	for _, key := range keys {
+		objectsCh <- key
+	}
+	close(objectsCh)
+
+	for e := range store.client.RemoveObjectsWithContext(ctx, store.Bucket, objectsCh) {
+		if e.ObjectName == "" {
+			return nil, minioError("remove", "", e.Err)
+		}
+		errs[e.ObjectName] = minioError("remove", e.ObjectName, e.Err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return batchResults(keys, errs), nil
+}
+
+// RemovePrefix 删除 prefix 下的所有对象
+func (store *MinioStorage) RemovePrefix(ctx context.Context, prefix string) ([]BatchResult, error) {
+	return removePrefix(ctx, store, prefix)
+}
+
+// StatMany minio 没有批量获取元数据的接口, 并发调用 StatObject
+func (store *MinioStorage) StatMany(ctx context.Context, keys []string) ([]BatchResult, error) {
+	return statMany(ctx, store, keys)
+}
+
 func (store *MinioStorage) Exist(key string) bool {
-	_, err := store.client.StatObject(store.Bucket, key, minio.StatObjectOptions{})
+	return store.ExistContext(context.Background(), key)
+}
+
+func (store *MinioStorage) ExistContext(ctx context.Context, key string) bool {
+	_, err := store.StatContext(ctx, key)
+	return err == nil
+}
+
+// Stat 获取对象的元数据
+func (store *MinioStorage) Stat(key string) (os.FileInfo, error) {
+	return store.StatContext(context.Background(), key)
+}
+
+// StatContext minio-go 的 StatObject 不支持 context, 只在请求前检查 ctx
+func (store *MinioStorage) StatContext(ctx context.Context, key string) (os.FileInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	key = strings.TrimPrefix(key, "/")
+	sse, err := store.sse(ctx, "stat", key, nil, true)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := store.client.StatObject(store.Bucket, key, minio.StatObjectOptions{
+		GetObjectOptions: minio.GetObjectOptions{ServerSideEncryption: sse},
+	})
 	if err != nil {
-		return false
+		return nil, minioError("stat", key, err)
 	}
-	return true
+	return minioObjectInfo(info), nil
 }
 
 func (store *MinioStorage) hasHttpPrefix(url string) bool {
 	return strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://")
 }
 
+// PutMultipart 使用 minio 的分片上传接口上传大文件, 支持断点续传
+func (store *MinioStorage) PutMultipart(ctx context.Context, key string, r io.ReaderAt, size int64, opts MultipartOptions) error {
+	return putMultipart(ctx, store, key, r, size, opts)
+}
+
+func (store *MinioStorage) initiateUpload(ctx context.Context, key string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	sse, err := store.sse(ctx, "put", key, nil, false)
+	if err != nil {
+		return "", err
+	}
+
+	core := minio.Core{Client: store.client}
+	uploadID, err := core.NewMultipartUpload(store.Bucket, key, minio.PutObjectOptions{ServerSideEncryption: sse})
+	if err != nil {
+		return "", minioError("put", key, err)
+	}
+	return uploadID, nil
+}
+
+func (store *MinioStorage) uploadPart(ctx context.Context, key, uploadID string, number int, r io.ReadSeeker, size int64) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	sse, err := store.sse(ctx, "put", key, nil, true)
+	if err != nil {
+		return "", err
+	}
+
+	core := minio.Core{Client: store.client}
+	part, err := core.PutObjectPart(store.Bucket, key, uploadID, number, r, size, "", "", sse)
+	if err != nil {
+		return "", minioError("put", key, err)
+	}
+	return part.ETag, nil
+}
+
+func (store *MinioStorage) completeUpload(ctx context.Context, key, uploadID string, parts []multipartPart) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var complete = make([]minio.CompletePart, 0, len(parts))
+	for _, part := range parts {
+		complete = append(complete, minio.CompletePart{PartNumber: part.Number, ETag: part.ETag})
+	}
+
+	core := minio.Core{Client: store.client}
+	if _, err := core.CompleteMultipartUpload(store.Bucket, key, uploadID, complete); err != nil {
+		return minioError("put", key, err)
+	}
+	return nil
+}
+
+func (store *MinioStorage) abortUpload(ctx context.Context, key, uploadID string) error {
+	core := minio.Core{Client: store.client}
+	if err := core.AbortMultipartUpload(store.Bucket, key, uploadID); err != nil {
+		return minioError("abort", key, err)
+	}
+	return nil
+}
+
+// AbortStaleUploads 取消 prefix 下发起时间早于 olderThan 的未完成上传
+func (store *MinioStorage) AbortStaleUploads(ctx context.Context, prefix string, olderThan time.Duration) (int, error) {
+	var (
+		core                      = minio.Core{Client: store.client}
+		deadline                  = time.Now().Add(-olderThan)
+		keyMarker, uploadIDMarker string
+		count                     int
+	)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return count, err
+		}
+
+		result, err := core.ListMultipartUploads(store.Bucket, prefix, keyMarker, uploadIDMarker, "", listPageSize)
+		if err != nil {
+			return count, minioError("abort", prefix, err)
+		}
+
+		for _, upload := range result.Uploads {
+			if upload.Initiated.After(deadline) {
+				continue
+			}
+			if err = store.abortUpload(ctx, upload.Key, upload.UploadID); err != nil {
+				return count, err
+			}
+			count++
+		}
+
+		if !result.IsTruncated {
+			return count, nil
+		}
+		keyMarker, uploadIDMarker = result.NextKeyMarker, result.NextUploadIDMarker
+	}
+}
+
+// SignedURL 生成预签名的 GET、HEAD 或 PUT 地址
+func (store *MinioStorage) SignedURL(key, method string, expiry time.Duration, opts *SignOptions) (string, error) {
+	method, err := signMethod(key, method, expiry)
+	if err != nil {
+		return "", err
+	}
+
+	key = strings.TrimPrefix(key, "/")
+
+	var params = make(url.Values)
+	if opts != nil && method != http.MethodPut {
+		if opts.ContentType != "" {
+			params.Set("response-content-type", opts.ContentType)
+		}
+		if opts.ContentDisposition != "" {
+			params.Set("response-content-disposition", opts.ContentDisposition)
+		}
+	}
+
+	var u *url.URL
+	switch method {
+	case http.MethodGet:
+		u, err = store.client.PresignedGetObject(store.Bucket, key, expiry, params)
+	case http.MethodHead:
+		u, err = store.client.PresignedHeadObject(store.Bucket, key, expiry, params)
+	default:
+		u, err = store.client.PresignedPutObject(store.Bucket, key, expiry)
+	}
+	if err != nil {
+		return "", minioError("sign", key, err)
+	}
+	return u.String(), nil
+}
+
+// UploadPolicy 生成表单直传策略, 优先使用 PresignedPostPolicy; minio-go 的
+// PostPolicy 不支持空的 key 前缀与 starts-with 的 Content-Type, 这时自行签名
+func (store *MinioStorage) UploadPolicy(keyPrefix string, maxSize int64, contentTypes []string, expiry time.Duration) (*PostPolicy, error) {
+	if err := checkPolicy(keyPrefix, maxSize, expiry); err != nil {
+		return nil, err
+	}
+
+	op, contentType, err := contentTypeCondition(keyPrefix, contentTypes)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		expires = time.Now().Add(expiry)
+		fields  map[string]string
+		u       *url.URL
+	)
+
+	if keyPrefix != "" && op != "starts-with" {
+		policy := minio.NewPostPolicy()
+		policy.SetBucket(store.Bucket)
+		policy.SetKeyStartsWith(keyPrefix)
+		policy.SetExpires(expires)
+		if maxSize > 0 {
+			policy.SetContentLengthRange(0, maxSize)
+		}
+		if op == "eq" {
+			policy.SetContentType(contentType)
+		}
+
+		if u, fields, err = store.client.PresignedPostPolicy(policy); err != nil {
+			return nil, minioError("policy", keyPrefix, err)
+		}
+		fields["key"] = keyPrefix + "${filename}"
+	} else {
+		var region = store.Region
+		if region == "" {
+			region = "us-east-1"
+		}
+
+		fields, err = signS3PostPolicy(s3PostCredential{
+			AccessKey: store.AccessKey,
+			SecretKey: store.AppSecret,
+			Region:    region,
+		}, store.Bucket, keyPrefix, maxSize, contentTypes, expires)
+		if err != nil {
+			return nil, err
+		}
+
+		u = &url.URL{Scheme: "http", Host: store.Endpoint, Path: "/" + store.Bucket + "/"}
+		if store.UseSSL {
+			u.Scheme = "https"
+		}
+	}
+
+	return &PostPolicy{URL: u.String(), Fields: fields, FileField: "file", Expires: expires}, nil
+}
+
 func (store *MinioStorage) WebURL(key string) (string, error) {
 	var (
 		u   *url.URL
@@ -232,4 +771,108 @@ func (store *MinioStorage) BucketURI(key string) BucketURI {
 	return BucketURI(fmt.Sprintf("%s://%s/%s", "minio", store.Bucket, key))
 }
 
-var _ Storage = &MinioStorage{}
+// minioObjectInfo 将 minio.ObjectInfo 转换为 ObjectInfo
+func minioObjectInfo(info minio.ObjectInfo) *ObjectInfo {
+	var storageClass = info.StorageClass
+	if storageClass == "" {
+		storageClass = info.Metadata.Get("X-Amz-Storage-Class")
+	}
+
+	return &ObjectInfo{
+		key:   info.Key,
+		size:  info.Size,
+		time:  info.LastModified,
+		isDir: strings.HasSuffix(info.Key, "/"),
+		meta: &ObjectMeta{
+			ContentType:        info.ContentType,
+			ContentEncoding:    info.Metadata.Get("Content-Encoding"),
+			ContentDisposition: info.Metadata.Get("Content-Disposition"),
+			CacheControl:       info.Metadata.Get("Cache-Control"),
+			Expires:            parseHTTPTime(info.Metadata.Get("Expires")),
+			ETag:               info.ETag,
+			StorageClass:       storageClass,
+			VersionID:          info.Metadata.Get("X-Amz-Version-Id"),
+			Metadata:           userMetadata(info.Metadata, "x-amz-meta-"),
+		},
+	}
+}
+
+// sse 返回本次调用使用的 minio-go 加密配置; read 为 true 时用于读取对象或作为
+// 复制源, 只需要提供 SSE-C 的密钥, SSE-S3 与 SSE-KMS 的请求头会被服务端拒绝
+func (store *MinioStorage) sse(ctx context.Context, op, key string, explicit *Encryption, read bool) (encrypt.ServerSide, error) {
+	enc, err := encryptionOf(ctx, op, key, explicit, store.Encryption)
+	if err != nil {
+		return nil, err
+	}
+	if read {
+		enc = enc.customerKey()
+	}
+
+	sse, err := minioSSE(enc)
+	if err != nil {
+		return nil, newError(op, key, ErrInvalid, err)
+	}
+	return sse, nil
+}
+
+// minioSSE 转换为 minio-go 的加密配置
+func minioSSE(enc *Encryption) (encrypt.ServerSide, error) {
+	if enc == nil {
+		return nil, nil
+	}
+
+	switch enc.Type {
+	case SSES3:
+		return encrypt.NewSSE(), nil
+	case SSEKMS:
+		return encrypt.NewSSEKMS(enc.KeyID, nil)
+	default:
+		return encrypt.NewSSEC(enc.Key)
+	}
+}
+
+// minioError 将 minio 的错误映射为 storage 错误
+func minioError(op, key string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var kind error
+	resp := minio.ToErrorResponse(err)
+	switch resp.Code {
+	case "":
+		kind = kindOfError(err)
+	case "NoSuchKey", "NoSuchBucket", "NoSuchUpload", "NoSuchVersion":
+		kind = ErrNotExist
+	case "BucketAlreadyExists", "BucketAlreadyOwnedByYou":
+		kind = ErrExist
+	case "AccessDenied", "AllAccessDisabled", "InvalidAccessKeyId", "SignatureDoesNotMatch":
+		kind = ErrPermission
+	case "InvalidArgument", "InvalidBucketName", "InvalidObjectName", "InvalidRange", "EntityTooLarge", "EntityTooSmall":
+		kind = ErrInvalid
+	case "NotImplemented":
+		kind = ErrNotImplemented
+	case "SlowDown":
+		kind = ErrThrottled
+	case "InternalError", "ServiceUnavailable", "RequestTimeout":
+		kind = ErrUnavailable
+	default:
+		kind = kindOfStatus(resp.StatusCode)
+	}
+	return newError(op, key, kind, err)
+}
+
+// keepsMetadata Stat 返回上传时的 Content-Encoding 与用户元数据
+func (store *MinioStorage) keepsMetadata() {}
+
+var (
+	_ StorageContext    = &MinioStorage{}
+	_ Lister            = &MinioStorage{}
+	_ Signer            = &MinioStorage{}
+	_ PolicySigner      = &MinioStorage{}
+	_ MultipartUploader = &MinioStorage{}
+	_ RangeReader       = &MinioStorage{}
+	_ Copier            = &MinioStorage{}
+	_ Batcher           = &MinioStorage{}
+	_ Putter            = &MinioStorage{}
+)
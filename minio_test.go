@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"os"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -27,7 +28,7 @@ func TestMinioStorage_Get(t *testing.T) {
 		secret = os.Getenv("MINIO_SECRET_KEY")
 		bucket = os.Getenv("MINIO_BUCKET")
 	)
-	store, err := NewMinio("minioadmin", "minioadmin", "forensics", MinioEndpoint("localhost:9000"))
+	store, err := NewMinio(key, secret, bucket, MinioEndpoint("localhost:9000"))
 	assert.NoError(t, err)
 
 	content, err := store.Get("/3.jpg")
@@ -137,3 +138,24 @@ func TestMinioStorage_WebURL(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, url, "http://localhost:9000/test.jpg")
 }
+
+func TestMinioStorage_register(t *testing.T) {
+	var registry = NewRegistry()
+
+	// 客户端创建失败时不注册
+	_, err := NewMinio("key", "secret", "broken", MinioEndpoint("localhost:9000/path"), MinioRegistry(registry))
+	assert.Error(t, err)
+	_, ok := registry.Lookup("minio", "broken")
+	assert.False(t, ok)
+
+	// 返回选项的错误
+	_, err = NewMinio("key", "secret", "broken", MinioRegistry(registry), func(*MinioStorage) error {
+		return ErrInvalid
+	})
+	assert.ErrorIs(t, err, ErrInvalid)
+
+	_, err = NewMinio("key", "secret", "photos", MinioEndpoint("localhost:9000"), MinioRegistry(registry))
+	assert.NoError(t, err)
+	_, ok = registry.Lookup("minio", "photos")
+	assert.True(t, ok)
+}
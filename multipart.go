@@ -0,0 +1,267 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// multipartMinPartSize S3 要求除最后一片外每片不小于 5MiB
+	multipartMinPartSize = 5 << 20
+	// multipartMaxParts S3 最多 10000 片
+	multipartMaxParts = 10000
+
+	defaultMultipartPartSize    = 16 << 20
+	defaultMultipartConcurrency = 4
+)
+
+// MultipartOptions 分片上传的选项
+//
+// PartSize 为分片大小, 默认 16MiB, 不小于 5MiB, 分片数超过 10000 时自动增大;
+// Concurrency 为同时上传的分片数, 默认 4; StateFile 不为空时保存上传进度,
+// 中断后使用相同的 StateFile 再次上传同一个文件会跳过已上传的分片, 上传完成后删除
+type MultipartOptions struct {
+	PartSize    int64
+	Concurrency int
+	StateFile   string
+}
+
+func (opts MultipartOptions) partSize(size int64) int64 {
+	var partSize = opts.PartSize
+	if partSize <= 0 {
+		partSize = defaultMultipartPartSize
+	}
+	if partSize < multipartMinPartSize {
+		partSize = multipartMinPartSize
+	}
+	for size/partSize >= multipartMaxParts {
+		partSize *= 2
+	}
+	return partSize
+}
+
+func (opts MultipartOptions) concurrency() int {
+	if opts.Concurrency <= 0 {
+		return defaultMultipartConcurrency
+	}
+	return opts.Concurrency
+}
+
+// MultipartUploader 支持分片上传大文件的存储
+type MultipartUploader interface {
+	// PutMultipart 分片上传 r 中 size 字节的内容
+	PutMultipart(ctx context.Context, key string, r io.ReaderAt, size int64, opts MultipartOptions) error
+	// AbortStaleUploads 取消 prefix 下发起时间早于 olderThan 的未完成上传, 返回取消的数量
+	AbortStaleUploads(ctx context.Context, prefix string, olderThan time.Duration) (int, error)
+}
+
+// PutFileMultipart 分片上传本地文件, store 未实现 MultipartUploader 时使用 PutReader
+func PutFileMultipart(ctx context.Context, store Storage, key string, file string, opts MultipartOptions) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return newError("put", key, nil, err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return newError("put", key, nil, err)
+	}
+
+	if uploader, ok := store.(MultipartUploader); ok {
+		return uploader.PutMultipart(ctx, key, f, info.Size(), opts)
+	}
+	return AdaptContext(store).PutReaderContext(ctx, key, f, info.Size())
+}
+
+// multipartPart 已上传的分片
+type multipartPart struct {
+	Number int    `json:"number"`
+	ETag   string `json:"etag"`
+}
+
+// multipartState 保存在 StateFile 中的上传进度
+type multipartState struct {
+	Key      string          `json:"key"`
+	UploadID string          `json:"upload_id"`
+	Size     int64           `json:"size"`
+	PartSize int64           `json:"part_size"`
+	Parts    []multipartPart `json:"parts"`
+}
+
+// multipartBackend 各存储的分片上传接口
+type multipartBackend interface {
+	initiateUpload(ctx context.Context, key string) (uploadID string, err error)
+	uploadPart(ctx context.Context, key, uploadID string, number int, r io.ReadSeeker, size int64) (etag string, err error)
+	completeUpload(ctx context.Context, key, uploadID string, parts []multipartPart) error
+	abortUpload(ctx context.Context, key, uploadID string) error
+}
+
+// putMultipart 分片上传的通用流程
+//
+// 出错时如果设置了 StateFile, 保留进度与未完成的上传以便续传, 否则取消上传;
+// 续传时服务端的上传已经不存在 (例如已被 AbortStaleUploads 清理) 则重新开始
+func putMultipart(ctx context.Context, backend multipartBackend, key string, r io.ReaderAt, size int64, opts MultipartOptions) error {
+	state, resumed := loadMultipartState(opts.StateFile, key, size, opts.partSize(size))
+
+	err := runMultipart(ctx, backend, state, r, opts)
+	if err != nil && resumed && errors.Is(err, ErrNotExist) {
+		os.Remove(opts.StateFile)
+		state, _ = loadMultipartState("", key, size, opts.partSize(size))
+		err = runMultipart(ctx, backend, state, r, opts)
+	}
+	return err
+}
+
+func runMultipart(ctx context.Context, backend multipartBackend, state *multipartState, r io.ReaderAt, opts MultipartOptions) (err error) {
+	if state.UploadID == "" {
+		if state.UploadID, err = backend.initiateUpload(ctx, state.Key); err != nil {
+			return err
+		}
+		if err = state.save(opts.StateFile); err != nil {
+			backend.abortUpload(context.Background(), state.Key, state.UploadID)
+			return newError("put", state.Key, nil, err)
+		}
+	}
+
+	var (
+		done   = make(map[int]bool)
+		count  = int((state.Size + state.PartSize - 1) / state.PartSize)
+		sem    = make(chan struct{}, opts.concurrency())
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		errOne error
+	)
+
+	for _, part := range state.Parts {
+		done[part.Number] = true
+	}
+
+	if count == 0 {
+		count = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for number := 1; number <= count; number++ {
+		if done[number] {
+			continue
+		}
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(number int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			var (
+				offset = int64(number-1) * state.PartSize
+				size   = state.PartSize
+			)
+			if offset+size > state.Size {
+				size = state.Size - offset
+			}
+
+			etag, err := backend.uploadPart(ctx, state.Key, state.UploadID, number, io.NewSectionReader(r, offset, size), size)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err == nil {
+				state.Parts = append(state.Parts, multipartPart{Number: number, ETag: etag})
+				if err = state.save(opts.StateFile); err != nil {
+					err = newError("put", state.Key, nil, err)
+				}
+			}
+
+			if err != nil && errOne == nil {
+				errOne = err
+				cancel()
+			}
+		}(number)
+	}
+	wg.Wait()
+
+	if errOne == nil {
+		errOne = ctx.Err()
+	}
+
+	if errOne != nil {
+		if opts.StateFile == "" {
+			backend.abortUpload(context.Background(), state.Key, state.UploadID)
+		}
+		return errOne
+	}
+
+	sort.Slice(state.Parts, func(i, j int) bool {
+		return state.Parts[i].Number < state.Parts[j].Number
+	})
+
+	if err = backend.completeUpload(ctx, state.Key, state.UploadID, state.Parts); err != nil {
+		return err
+	}
+
+	if opts.StateFile != "" {
+		os.Remove(opts.StateFile)
+	}
+	return nil
+}
+
+// loadMultipartState 读取上传进度, 与本次上传的 key、大小或分片大小不一致时重新开始
+func loadMultipartState(file string, key string, size, partSize int64) (*multipartState, bool) {
+	var fresh = &multipartState{Key: key, Size: size, PartSize: partSize}
+	if file == "" {
+		return fresh, false
+	}
+
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return fresh, false
+	}
+
+	var state multipartState
+	if err = json.Unmarshal(b, &state); err != nil {
+		return fresh, false
+	}
+
+	if state.Key != key || state.Size != size || state.PartSize != partSize || state.UploadID == "" {
+		return fresh, false
+	}
+	return &state, true
+}
+
+// save 写入临时文件后重命名, 避免崩溃时留下不完整的进度
+func (state *multipartState) save(file string) error {
+	if file == "" {
+		return nil
+	}
+
+	b, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	tmp := fmt.Sprintf("%s.%d.tmp", file, os.Getpid())
+	if err = ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
@@ -0,0 +1,184 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeMultipart 记录分片的内存实现, failPart 对应的分片第一次上传时失败
+type fakeMultipart struct {
+	mu        sync.Mutex
+	uploads   map[string]map[int][]byte
+	completed map[string][]byte
+	aborted   []string
+	uploaded  []int
+	failPart  int
+	failErr   error
+	nextID    int
+}
+
+func newFakeMultipart() *fakeMultipart {
+	return &fakeMultipart{uploads: make(map[string]map[int][]byte), completed: make(map[string][]byte)}
+}
+
+func (fake *fakeMultipart) initiateUpload(ctx context.Context, key string) (string, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	fake.nextID++
+	id := fmt.Sprintf("upload-%d", fake.nextID)
+	fake.uploads[id] = make(map[int][]byte)
+	return id, nil
+}
+
+func (fake *fakeMultipart) uploadPart(ctx context.Context, key, uploadID string, number int, r io.ReadSeeker, size int64) (string, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	if number == fake.failPart {
+		fake.failPart = 0
+		return "", fake.failErr
+	}
+
+	parts, ok := fake.uploads[uploadID]
+	if !ok {
+		return "", newError("put", key, ErrNotExist, nil)
+	}
+
+	parts[number] = b
+	fake.uploaded = append(fake.uploaded, number)
+	return fmt.Sprintf("etag-%d", number), nil
+}
+
+func (fake *fakeMultipart) completeUpload(ctx context.Context, key, uploadID string, parts []multipartPart) error {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	var buf bytes.Buffer
+	for i, part := range parts {
+		if part.Number != i+1 || part.ETag != fmt.Sprintf("etag-%d", part.Number) {
+			return fmt.Errorf("unexpected part %v", part)
+		}
+		buf.Write(fake.uploads[uploadID][part.Number])
+	}
+
+	fake.completed[key] = buf.Bytes()
+	delete(fake.uploads, uploadID)
+	return nil
+}
+
+func (fake *fakeMultipart) abortUpload(ctx context.Context, key, uploadID string) error {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	fake.aborted = append(fake.aborted, uploadID)
+	delete(fake.uploads, uploadID)
+	return nil
+}
+
+func multipartData() []byte {
+	return bytes.Repeat([]byte("0123456789abcdef"), (multipartMinPartSize*3+1024)/16)
+}
+
+func TestPutMultipart(t *testing.T) {
+	var (
+		fake = newFakeMultipart()
+		data = multipartData()
+	)
+
+	err := putMultipart(context.Background(), fake, "big.bin", bytes.NewReader(data), int64(len(data)), MultipartOptions{PartSize: 1, Concurrency: 2})
+	assert.NoError(t, err)
+	assert.Len(t, fake.uploaded, 4)
+	assert.Equal(t, data, fake.completed["big.bin"])
+}
+
+func TestPutMultipart_Resume(t *testing.T) {
+	var (
+		fake  = newFakeMultipart()
+		data  = multipartData()
+		state = filepath.Join(t.TempDir(), "big.json")
+		opts  = MultipartOptions{Concurrency: 1, StateFile: state, PartSize: multipartMinPartSize}
+	)
+
+	fake.failPart, fake.failErr = 3, ErrUnavailable
+	err := putMultipart(context.Background(), fake, "big.bin", bytes.NewReader(data), int64(len(data)), opts)
+	assert.True(t, errors.Is(err, ErrUnavailable))
+	assert.Empty(t, fake.aborted)
+	assert.FileExists(t, state)
+
+	// 续传时只上传失败及之后的分片
+	fake.uploaded = nil
+	err = putMultipart(context.Background(), fake, "big.bin", bytes.NewReader(data), int64(len(data)), opts)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []int{3, 4}, fake.uploaded)
+	assert.Equal(t, data, fake.completed["big.bin"])
+
+	_, err = os.Stat(state)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestPutMultipart_ResumeExpired(t *testing.T) {
+	var (
+		fake  = newFakeMultipart()
+		data  = multipartData()
+		state = filepath.Join(t.TempDir(), "big.json")
+		opts  = MultipartOptions{Concurrency: 1, StateFile: state, PartSize: multipartMinPartSize}
+	)
+
+	fake.failPart, fake.failErr = 2, ErrUnavailable
+	err := putMultipart(context.Background(), fake, "big.bin", bytes.NewReader(data), int64(len(data)), opts)
+	assert.Error(t, err)
+
+	// 服务端已清理未完成的上传, 重新开始
+	fake.uploads = make(map[string]map[int][]byte)
+	err = putMultipart(context.Background(), fake, "big.bin", bytes.NewReader(data), int64(len(data)), opts)
+	assert.NoError(t, err)
+	assert.Equal(t, data, fake.completed["big.bin"])
+}
+
+func TestPutMultipart_Abort(t *testing.T) {
+	var (
+		fake = newFakeMultipart()
+		data = multipartData()
+	)
+
+	fake.failPart, fake.failErr = 2, ErrPermission
+	err := putMultipart(context.Background(), fake, "big.bin", bytes.NewReader(data), int64(len(data)), MultipartOptions{PartSize: multipartMinPartSize})
+	assert.True(t, errors.Is(err, ErrPermission))
+	assert.Equal(t, []string{"upload-1"}, fake.aborted)
+	assert.Empty(t, fake.completed)
+}
+
+func TestMultipartOptions_partSize(t *testing.T) {
+	assert.Equal(t, int64(defaultMultipartPartSize), MultipartOptions{}.partSize(1<<30))
+	assert.Equal(t, int64(multipartMinPartSize), MultipartOptions{PartSize: 1}.partSize(1<<30))
+	assert.True(t, MultipartOptions{}.partSize(1<<40) >= (1<<40)/multipartMaxParts)
+}
+
+func TestPutFileMultipart(t *testing.T) {
+	store, err := NewMemory("multipart", MemoryRegistry(NewRegistry()))
+	assert.NoError(t, err)
+
+	file := filepath.Join(t.TempDir(), "a.txt")
+	assert.NoError(t, ioutil.WriteFile(file, []byte("hello world"), 0644))
+
+	assert.NoError(t, PutFileMultipart(context.Background(), store, "a.txt", file, MultipartOptions{}))
+	content, err := store.Get("a.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world", string(content))
+}
@@ -1,7 +1,9 @@
 package storage
 
 import (
+	"net/http"
 	"os"
+	"strings"
 	"time"
 )
 
@@ -11,6 +13,23 @@ type ObjectInfo struct {
 	size  int64
 	time  time.Time
 	isDir bool
+	meta  *ObjectMeta
+}
+
+// ObjectMeta 对象的扩展元数据, 由 Stat 返回并通过 ObjectInfo.Sys() 取得
+//
+// Metadata 为用户自定义元数据, key 统一为小写且不带 x-amz-meta- 之类的前缀;
+// 后端不支持的字段保持零值
+type ObjectMeta struct {
+	ContentType        string
+	ContentEncoding    string
+	ContentDisposition string
+	CacheControl       string
+	Expires            time.Time
+	ETag               string
+	StorageClass       string
+	VersionID          string
+	Metadata           map[string]string
 }
 
 func (obj *ObjectInfo) Name() string {
@@ -33,6 +52,45 @@ func (obj *ObjectInfo) IsDir() bool {
 	return obj.isDir
 }
 
+// Sys 返回 *ObjectMeta, 没有元数据时返回 nil
 func (obj *ObjectInfo) Sys() interface{} {
-	return nil
+	if obj.meta == nil {
+		return nil
+	}
+	return obj.meta
+}
+
+// MetaOf 取出文件信息中的 *ObjectMeta, 没有时返回 nil
+func MetaOf(info os.FileInfo) *ObjectMeta {
+	if info == nil {
+		return nil
+	}
+
+	meta, _ := info.Sys().(*ObjectMeta)
+	return meta
+}
+
+// userMetadata 从 http 头中取出带有 prefix 前缀的用户元数据
+func userMetadata(header http.Header, prefix string) map[string]string {
+	var meta = make(map[string]string)
+	for k, v := range header {
+		if len(v) == 0 {
+			continue
+		}
+
+		k = strings.ToLower(k)
+		if strings.HasPrefix(k, prefix) {
+			meta[strings.TrimPrefix(k, prefix)] = v[0]
+		}
+	}
+	return meta
+}
+
+// parseHTTPTime 解析 Expires 之类的 http 时间, 格式错误时返回零值
+func parseHTTPTime(s string) time.Time {
+	t, err := http.ParseTime(s)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
 }
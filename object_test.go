@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMinioObjectInfo(t *testing.T) {
+	var now = time.Now()
+	info := minioObjectInfo(minio.ObjectInfo{
+		Key:          "images/a.png",
+		Size:         10,
+		LastModified: now,
+		ETag:         "abc",
+		ContentType:  "image/png",
+		Metadata: http.Header{
+			"Cache-Control":       []string{"max-age=60"},
+			"X-Amz-Meta-Author":   []string{"hysios"},
+			"X-Amz-Version-Id":    []string{"v1"},
+			"X-Amz-Storage-Class": []string{"STANDARD_IA"},
+		},
+	})
+
+	assert.Equal(t, "images/a.png", info.Name())
+	assert.Equal(t, int64(10), info.Size())
+	assert.Equal(t, now, info.ModTime())
+
+	meta := MetaOf(info)
+	if assert.NotNil(t, meta) {
+		assert.Equal(t, "image/png", meta.ContentType)
+		assert.Equal(t, "max-age=60", meta.CacheControl)
+		assert.Equal(t, "abc", meta.ETag)
+		assert.Equal(t, "v1", meta.VersionID)
+		assert.Equal(t, "STANDARD_IA", meta.StorageClass)
+		assert.Equal(t, map[string]string{"author": "hysios"}, meta.Metadata)
+	}
+}
+
+func TestMetaOf(t *testing.T) {
+	assert.Nil(t, MetaOf(nil))
+	assert.Nil(t, MetaOf(&ObjectInfo{key: "a"}))
+	assert.Nil(t, (&ObjectInfo{key: "a"}).Sys())
+}
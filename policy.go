@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// PostPolicy 浏览器表单直传所需的信息
+//
+// 客户端向 URL 发送 multipart/form-data 的 POST 请求, 带上 Fields 中的所有字段,
+// 文件内容放在 FileField 字段中, 并且必须是表单的最后一个字段
+type PostPolicy struct {
+	URL       string
+	Fields    map[string]string
+	FileField string
+	Expires   time.Time
+}
+
+// PolicySigner 支持生成表单直传策略的存储
+//
+// 上传的 key 必须以 keyPrefix 开头; maxSize 为文件大小上限, 0 不限制;
+// contentTypes 为允许的 Content-Type, 可以使用 image/* 的形式, 为空不限制;
+// S3 与 minio 只支持一个类型或者一个主类型, 多个类型时返回 ErrInvalid
+type PolicySigner interface {
+	UploadPolicy(keyPrefix string, maxSize int64, contentTypes []string, expiry time.Duration) (*PostPolicy, error)
+}
+
+// UploadPolicy 生成 store 的表单直传策略, store 未实现 PolicySigner 时返回 ErrNotImplemented
+func UploadPolicy(store Storage, keyPrefix string, maxSize int64, contentTypes []string, expiry time.Duration) (*PostPolicy, error) {
+	signer, ok := store.(PolicySigner)
+	if !ok {
+		return nil, newError("policy", keyPrefix, ErrNotImplemented, nil)
+	}
+	return signer.UploadPolicy(keyPrefix, maxSize, contentTypes, expiry)
+}
+
+// checkPolicy 检查直传策略的参数
+func checkPolicy(keyPrefix string, maxSize int64, expiry time.Duration) error {
+	if expiry <= 0 {
+		return newError("policy", keyPrefix, ErrInvalid, fmt.Errorf("invalid expiry %s", expiry))
+	}
+	if maxSize < 0 {
+		return newError("policy", keyPrefix, ErrInvalid, fmt.Errorf("invalid max size %d", maxSize))
+	}
+	return nil
+}
+
+// contentTypeCondition 将允许的 Content-Type 转换为 POST policy 的条件
+//
+// POST policy 只支持 eq 与 starts-with, 只能准确表达一个类型或者一个 image/*
+// 形式的主类型; 多个不同的类型不会放宽为主类型前缀, 返回 ErrInvalid, 需要允许
+// 整个主类型时由调用者显式使用 image/*
+func contentTypeCondition(keyPrefix string, contentTypes []string) (op, value string, err error) {
+	var exact, wildcard string
+	for _, typ := range contentTypes {
+		if !strings.HasSuffix(typ, "/*") {
+			continue
+		}
+		if major := strings.TrimSuffix(typ, "*"); wildcard == "" {
+			wildcard = major
+		} else if wildcard != major {
+			return "", "", newError("policy", keyPrefix, ErrInvalid, fmt.Errorf("content types %v have no common prefix", contentTypes))
+		}
+	}
+
+	for _, typ := range contentTypes {
+		switch {
+		case strings.HasSuffix(typ, "/*"):
+		case wildcard != "":
+			if !strings.HasPrefix(typ, wildcard) {
+				return "", "", newError("policy", keyPrefix, ErrInvalid, fmt.Errorf("content types %v have no common prefix", contentTypes))
+			}
+		case exact != "" && exact != typ:
+			return "", "", newError("policy", keyPrefix, ErrInvalid, fmt.Errorf("content types %v cannot be matched exactly, use %s* to allow the major type", contentTypes, majorType(exact)))
+		default:
+			exact = typ
+		}
+	}
+
+	switch {
+	case wildcard != "":
+		return "starts-with", wildcard, nil
+	case exact != "":
+		return "eq", exact, nil
+	}
+	return "", "", nil
+}
+
+// majorType 返回 Content-Type 的主类型, 包含结尾的 /
+func majorType(typ string) string {
+	if i := strings.Index(typ, "/"); i >= 0 {
+		return typ[:i+1]
+	}
+	return typ
+}
+
+// s3PostCredential 生成 SigV4 POST policy 所需的密钥信息
+type s3PostCredential struct {
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	Region       string
+}
+
+// signS3PostPolicy 按 AWS Signature Version 4 生成 POST policy 的表单字段,
+// 用于 minio-go 的 PostPolicy 无法表达的条件
+func signS3PostPolicy(cred s3PostCredential, bucket, keyPrefix string, maxSize int64, contentTypes []string, expires time.Time) (map[string]string, error) {
+	var (
+		now        = time.Now().UTC()
+		date       = now.Format("20060102")
+		amzDate    = now.Format("20060102T150405Z")
+		credential = fmt.Sprintf("%s/%s/%s/s3/aws4_request", cred.AccessKey, date, cred.Region)
+		conditions = []interface{}{
+			map[string]string{"bucket": bucket},
+			[]interface{}{"starts-with", "$key", keyPrefix},
+			map[string]string{"x-amz-algorithm": "AWS4-HMAC-SHA256"},
+			map[string]string{"x-amz-credential": credential},
+			map[string]string{"x-amz-date": amzDate},
+		}
+		fields = map[string]string{
+			"key":              keyPrefix + "${filename}",
+			"x-amz-algorithm":  "AWS4-HMAC-SHA256",
+			"x-amz-credential": credential,
+			"x-amz-date":       amzDate,
+		}
+	)
+
+	if maxSize > 0 {
+		conditions = append(conditions, []interface{}{"content-length-range", 0, maxSize})
+	}
+
+	op, value, err := contentTypeCondition(keyPrefix, contentTypes)
+	if err != nil {
+		return nil, err
+	}
+	if op != "" {
+		conditions = append(conditions, []interface{}{op, "$Content-Type", value})
+		if op == "eq" {
+			fields["Content-Type"] = value
+		}
+	}
+
+	if cred.SessionToken != "" {
+		conditions = append(conditions, map[string]string{"x-amz-security-token": cred.SessionToken})
+		fields["x-amz-security-token"] = cred.SessionToken
+	}
+
+	policy, err := json.Marshal(map[string]interface{}{
+		"expiration": expires.UTC().Format("2006-01-02T15:04:05.000Z"),
+		"conditions": conditions,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fields["policy"] = base64.StdEncoding.EncodeToString(policy)
+
+	var key = []byte("AWS4" + cred.SecretKey)
+	for _, data := range []string{date, cred.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, data)
+	}
+	fields["x-amz-signature"] = hex.EncodeToString(hmacSHA256(key, fields["policy"]))
+	return fields, nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
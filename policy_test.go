@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContentTypeCondition(t *testing.T) {
+	tests := []struct {
+		types []string
+		op    string
+		value string
+		err   error
+	}{
+		{types: nil},
+		{types: []string{"image/png"}, op: "eq", value: "image/png"},
+		{types: []string{"image/*"}, op: "starts-with", value: "image/"},
+		{types: []string{"image/png", "image/png"}, op: "eq", value: "image/png"},
+		{types: []string{"image/png", "image/*"}, op: "starts-with", value: "image/"},
+		// 多个类型不会放宽为主类型
+		{types: []string{"image/png", "image/jpeg"}, err: ErrInvalid},
+		{types: []string{"image/png", "video/mp4"}, err: ErrInvalid},
+		{types: []string{"image/*", "video/mp4"}, err: ErrInvalid},
+		{types: []string{"image/*", "video/*"}, err: ErrInvalid},
+	}
+
+	for _, tt := range tests {
+		op, value, err := contentTypeCondition("", tt.types)
+		if tt.err != nil {
+			assert.True(t, errors.Is(err, tt.err), "%v", tt.types)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, tt.op, op)
+		assert.Equal(t, tt.value, value)
+	}
+}
+
+// decodePolicy 解析 POST policy 中的条件
+func decodePolicy(t *testing.T, fields map[string]string) []interface{} {
+	b, err := base64.StdEncoding.DecodeString(fields["policy"])
+	assert.NoError(t, err)
+
+	var policy struct {
+		Conditions []interface{} `json:"conditions"`
+	}
+	assert.NoError(t, json.Unmarshal(b, &policy))
+	return policy.Conditions
+}
+
+func TestSignS3PostPolicy(t *testing.T) {
+	fields, err := signS3PostPolicy(s3PostCredential{
+		AccessKey: "key",
+		SecretKey: "secret",
+		Region:    "us-east-1",
+	}, "images", "avatars/", 1<<20, []string{"image/*"}, time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+
+	assert.Equal(t, "avatars/${filename}", fields["key"])
+	assert.True(t, strings.HasPrefix(fields["x-amz-credential"], "key/"))
+
+	conditions := decodePolicy(t, fields)
+	assert.Contains(t, conditions, []interface{}{"starts-with", "$key", "avatars/"})
+	assert.Contains(t, conditions, []interface{}{"content-length-range", float64(0), float64(1 << 20)})
+	assert.Contains(t, conditions, []interface{}{"starts-with", "$Content-Type", "image/"})
+
+	var key = []byte("AWS4secret")
+	for _, data := range []string{fields["x-amz-date"][:8], "us-east-1", "s3", "aws4_request"} {
+		key = hmacSHA256(key, data)
+	}
+	assert.Equal(t, hex.EncodeToString(hmacSHA256(key, fields["policy"])), fields["x-amz-signature"])
+}
+
+func TestMinioStorage_UploadPolicy(t *testing.T) {
+	store, err := NewMinio("key", "secret", "policy-minio", MinioEndpoint("127.0.0.1:9000"), MinioRegion("us-east-1"), MinioRegistry(NewRegistry()))
+	assert.NoError(t, err)
+
+	policy, err := store.UploadPolicy("avatars/", 1<<20, []string{"image/png"}, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, "http://127.0.0.1:9000/policy-minio/", policy.URL)
+	assert.Equal(t, "avatars/${filename}", policy.Fields["key"])
+	assert.Equal(t, "image/png", policy.Fields["Content-Type"])
+	assert.NotEmpty(t, policy.Fields["x-amz-signature"])
+	assert.Equal(t, "file", policy.FileField)
+
+	// 多个类型只能显式允许整个主类型
+	_, err = store.UploadPolicy("", 0, []string{"image/png", "image/jpeg"}, time.Hour)
+	assert.True(t, errors.Is(err, ErrInvalid))
+
+	policy, err = store.UploadPolicy("", 0, []string{"image/*"}, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, "http://127.0.0.1:9000/policy-minio/", policy.URL)
+	assert.Contains(t, decodePolicy(t, policy.Fields), []interface{}{"starts-with", "$Content-Type", "image/"})
+
+	_, err = store.UploadPolicy("avatars/", 0, nil, 0)
+	assert.True(t, errors.Is(err, ErrInvalid))
+}
+
+func TestS3ObjectStorage_UploadPolicy(t *testing.T) {
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("cn-hangzhou"),
+		Endpoint:    aws.String("https://oss-cn-hangzhou.aliyuncs.com"),
+		Credentials: credentials.NewStaticCredentials("key", "secret", "token"),
+	}))
+
+	store, err := NewS3("key", "secret", "policy-s3", sess, S3WebPrefix("http://s3.example.com"), S3Registry(NewRegistry()))
+	assert.NoError(t, err)
+
+	policy, err := store.UploadPolicy("avatars/", 1<<20, nil, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://policy-s3.oss-cn-hangzhou.aliyuncs.com/", policy.URL)
+	assert.Equal(t, "token", policy.Fields["x-amz-security-token"])
+	assert.Contains(t, policy.Fields["x-amz-credential"], "/cn-hangzhou/s3/aws4_request")
+}
+
+func TestQiniuStorage_UploadPolicy(t *testing.T) {
+	store := NewQiniuStorage(&QiniuConfig{
+		AppKey:       "ak",
+		Secret:       "sk",
+		Bucket:       "policy-qiniu",
+		Region:       "huadong",
+		CallbackURL:  "https://api.example.com/qiniu/callback",
+		CallbackBody: "key=$(key)&hash=$(etag)",
+		Registry:     NewRegistry(),
+	})
+
+	policy, err := store.UploadPolicy("avatars/", 1<<20, []string{"image/*"}, time.Hour)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(policy.URL, "http://"))
+
+	parts := strings.Split(policy.Fields["token"], ":")
+	assert.Len(t, parts, 3)
+	b, err := base64.URLEncoding.DecodeString(parts[2])
+	assert.NoError(t, err)
+
+	var putPolicy map[string]interface{}
+	assert.NoError(t, json.Unmarshal(b, &putPolicy))
+	assert.Equal(t, "policy-qiniu:avatars/", putPolicy["scope"])
+	assert.Equal(t, float64(1), putPolicy["isPrefixalScope"])
+	assert.Equal(t, "avatars/$(fname)", putPolicy["saveKey"])
+	assert.Equal(t, float64(1<<20), putPolicy["fsizeLimit"])
+	assert.Equal(t, "image/*", putPolicy["mimeLimit"])
+	assert.Equal(t, "https://api.example.com/qiniu/callback", putPolicy["callbackUrl"])
+	assert.Equal(t, "key=$(key)&hash=$(etag)", putPolicy["callbackBody"])
+}
@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+)
+
+// sniffLen http.DetectContentType 最多使用的字节数
+const sniffLen = 512
+
+// PutOptions 上传对象的选项
+//
+// ContentType 为空时先根据 key 的扩展名推断, 没有扩展名时读取内容的前 512 字节
+// 推断; Metadata 为用户自定义元数据; StorageClass 为存储类型, 取值与 ObjectMeta
+// 相同; Encryption 为服务端加密, 为空时使用 ctx 或存储的默认配置. 后端不支持的
+// 选项会被忽略, 见各存储的 PutObject
+type PutOptions struct {
+	ContentType        string
+	ContentDisposition string
+	CacheControl       string
+	ContentEncoding    string
+	Metadata           map[string]string
+	StorageClass       string
+	Encryption         *Encryption
+}
+
+// Putter 支持上传时设置元数据的存储
+type Putter interface {
+	PutObject(key string, r io.Reader, size int64, opts PutOptions) error
+	PutObjectContext(ctx context.Context, key string, r io.Reader, size int64, opts PutOptions) error
+}
+
+// PutObject 上传对象并设置元数据, store 未实现 Putter 时忽略 opts 使用 PutReader
+func PutObject(ctx context.Context, store Storage, key string, r io.Reader, size int64, opts PutOptions) error {
+	if putter, ok := store.(Putter); ok {
+		return putter.PutObjectContext(ctx, key, r, size, opts)
+	}
+	return AdaptContext(store).PutReaderContext(ctx, key, r, size)
+}
+
+// putFile 打开本地文件后调用 PutObjectContext, 由内容推断 Content-Type
+func putFile(ctx context.Context, putter Putter, key string, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return newError("put", key, nil, err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return newError("put", key, nil, err)
+	}
+	return putter.PutObjectContext(ctx, key, f, info.Size(), PutOptions{})
+}
+
+// detect 补全 ContentType, 返回的 Reader 包含推断时已读取的内容;
+// r 可以 Seek 时读取后回到原来的位置, 仍然返回 r 本身
+func (opts *PutOptions) detect(key string, r io.Reader) (io.Reader, error) {
+	if opts.ContentType != "" {
+		return r, nil
+	}
+
+	if contentType := mime.TypeByExtension(path.Ext(key)); contentType != "" {
+		opts.ContentType = contentType
+		return r, nil
+	}
+
+	var head = make([]byte, sniffLen)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, newError("put", key, nil, err)
+	}
+	head = head[:n]
+	opts.ContentType = http.DetectContentType(head)
+
+	if rs, ok := r.(io.ReadSeeker); ok {
+		if _, err = rs.Seek(int64(-n), io.SeekCurrent); err == nil {
+			return r, nil
+		}
+	}
+	return io.MultiReader(bytes.NewReader(head), r), nil
+}
+
+// meta 转换为 ObjectMeta, 用于不需要请求服务端的存储
+func (opts PutOptions) meta() ObjectMeta {
+	return ObjectMeta{
+		ContentType:        opts.ContentType,
+		ContentDisposition: opts.ContentDisposition,
+		CacheControl:       opts.CacheControl,
+		ContentEncoding:    opts.ContentEncoding,
+		StorageClass:       opts.StorageClass,
+		Metadata:           cloneMetadata(opts.Metadata),
+	}
+}
+
+// cloneMetadata 复制用户元数据, nil 时返回 nil
+func cloneMetadata(metadata map[string]string) map[string]string {
+	if metadata == nil {
+		return nil
+	}
+
+	var clone = make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		clone[k] = v
+	}
+	return clone
+}
@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// onlyReader 隐藏 io.Seeker
+type onlyReader struct {
+	r *strings.Reader
+}
+
+func (r onlyReader) Read(p []byte) (int, error) {
+	return r.r.Read(p)
+}
+
+func TestPutOptions_detect(t *testing.T) {
+	var png = "\x89PNG\r\n\x1a\n" + strings.Repeat("0", 1024)
+
+	tests := []struct {
+		key, content, contentType, want string
+	}{
+		{"a.txt", "hello", "", "text/plain; charset=utf-8"},
+		{"a.txt", "hello", "application/json", "application/json"},
+		{"avatar", png, "", "image/png"},
+		{"page", "<html><body></body></html>", "", "text/html; charset=utf-8"},
+		{"empty", "", "", "text/plain; charset=utf-8"},
+	}
+
+	for _, tt := range tests {
+		for _, r := range []io.Reader{strings.NewReader(tt.content), onlyReader{strings.NewReader(tt.content)}} {
+			opts := PutOptions{ContentType: tt.contentType}
+			got, err := opts.detect(tt.key, r)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, opts.ContentType, tt.key)
+
+			// 推断时读取的内容不会丢失
+			b, err := ioutil.ReadAll(got)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.content, string(b))
+		}
+	}
+}
+
+func TestMemoryStorage_PutObject(t *testing.T) {
+	store, err := NewMemory("put", MemoryRegistry(NewRegistry()))
+	assert.NoError(t, err)
+
+	err = store.PutObject("report", bytes.NewReader([]byte("%PDF-1.4 ...")), 12, PutOptions{
+		ContentDisposition: `attachment; filename="report.pdf"`,
+		CacheControl:       "no-cache",
+		Metadata:           map[string]string{"owner": "alice"},
+	})
+	assert.NoError(t, err)
+
+	info, err := store.Stat("report")
+	assert.NoError(t, err)
+	meta := MetaOf(info)
+	assert.Equal(t, "application/pdf", meta.ContentType)
+	assert.Equal(t, `attachment; filename="report.pdf"`, meta.ContentDisposition)
+	assert.Equal(t, "no-cache", meta.CacheControl)
+	assert.Equal(t, map[string]string{"owner": "alice"}, meta.Metadata)
+	assert.NotEmpty(t, meta.ETag)
+
+	content, err := store.Get("report")
+	assert.NoError(t, err)
+	assert.Equal(t, "%PDF-1.4 ...", string(content))
+}
+
+func TestPutObject(t *testing.T) {
+	local, err := NewLocal(t.TempDir(), LocalRegistry(NewRegistry()))
+	assert.NoError(t, err)
+
+	mem, err := NewMemory("put-plain", MemoryRegistry(NewRegistry()))
+	assert.NoError(t, err)
+
+	for _, store := range []Storage{local, plainStorage{mem}} {
+		err = PutObject(context.Background(), store, "a.txt", strings.NewReader("hello"), 5, PutOptions{ContentType: "text/markdown"})
+		assert.NoError(t, err)
+		content, err := store.Get("a.txt")
+		assert.NoError(t, err)
+		assert.Equal(t, "hello", string(content))
+	}
+
+	file := filepath.Join(t.TempDir(), "image")
+	assert.NoError(t, ioutil.WriteFile(file, []byte("GIF89a..."), 0644))
+	assert.NoError(t, mem.PutFile("image", file))
+	info, err := mem.Stat("image")
+	assert.NoError(t, err)
+	assert.Equal(t, "image/gif", MetaOf(info).ContentType)
+}
@@ -4,13 +4,20 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
 	"net/url"
 	"os"
 	"path"
+	"strings"
+	"time"
 
 	"github.com/hysios/log"
 	"github.com/qiniu/go-sdk/v7/auth"
 	"github.com/qiniu/go-sdk/v7/auth/qbox"
+	"github.com/qiniu/go-sdk/v7/client"
 	"github.com/qiniu/go-sdk/v7/sms/bytes"
 	"github.com/qiniu/go-sdk/v7/storage"
 )
@@ -28,8 +35,20 @@ type QiniuConfig struct {
 	ParentDir  string
 	Region     string
 	HttpPrefix string
+	// Private 为私有空间, 下载时使用带签名的私有链接
+	Private bool
+	// CallbackURL 直传成功后七牛回调的地址, CallbackBody 为回调内容,
+	// 例如 key=$(key)&hash=$(etag), CallbackBodyType 为回调内容的类型
+	CallbackURL      string
+	CallbackBody     string
+	CallbackBodyType string
+	// Registry 注册到指定的注册表, 为 nil 时注册到 DefaultRegistry
+	Registry *Registry
 }
 
+// qiniuDownloadExpiry 私有空间下载链接的有效期
+const qiniuDownloadExpiry = time.Hour
+
 var qiniuRegionMap = map[string]storage.Region{
 	"huadong":  storage.ZoneHuadong,
 	"huabei":   storage.ZoneHuabei,
@@ -45,27 +64,12 @@ func NewQiniuStorage(cfg *QiniuConfig) *QiniuStorage {
 		mac:    qbox.NewMac(cfg.AppKey, cfg.Secret),
 	}
 
-	register("qiniu", store, cfg.Bucket)
+	register(cfg.Registry, "qiniu", store, cfg.Bucket)
 	return store
 }
 
-func (qiniu *QiniuStorage) List(prefix string) ([]os.FileInfo, error) {
-	return nil, errors.New("not implemented")
-}
-
-func (qiniu *QiniuStorage) Get(key string) ([]byte, error) {
-	return nil, errors.New("not implemented")
-}
-
-// PutFile 上传一个文件
-func (qiniu *QiniuStorage) PutFile(key string, localfile string) error {
-	bucket := qiniu.Config.Bucket
-
-	putPolicy := storage.PutPolicy{
-		Scope: bucket,
-	}
-
-	upToken := putPolicy.UploadToken(qiniu.mac)
+// config 构建七牛 SDK 配置
+func (qiniu *QiniuStorage) config() *storage.Config {
 	cfg := storage.Config{}
 	// 空间对应的机房
 
@@ -78,119 +82,533 @@ func (qiniu *QiniuStorage) PutFile(key string, localfile string) error {
 	cfg.UseHTTPS = false
 	// 上传是否使用CDN上传加速
 	cfg.UseCdnDomains = false
-	// 构建表单上传的对象
-	formUploader := storage.NewFormUploader(&cfg)
-	ret := storage.PutRet{}
-	// 可选配置
-	putExtra := storage.PutExtra{
-		Params: nil,
+	return &cfg
+}
+
+func (qiniu *QiniuStorage) bucketManager() *storage.BucketManager {
+	return storage.NewBucketManager(qiniu.mac, qiniu.config())
+}
+
+func (qiniu *QiniuStorage) upToken() string {
+	return qiniu.putToken(0)
+}
+
+// putToken 上传凭证, 存储类型只能通过上传策略的 FileType 指定
+func (qiniu *QiniuStorage) putToken(fileType int) string {
+	putPolicy := storage.PutPolicy{
+		Scope:    qiniu.Config.Bucket,
+		FileType: fileType,
 	}
-	err := formUploader.PutFile(context.Background(), &ret, upToken, key, localfile, &putExtra)
+
+	return putPolicy.UploadToken(qiniu.mac)
+}
+
+func (qiniu *QiniuStorage) List(prefix string) ([]os.FileInfo, error) {
+	return qiniu.ListContext(context.Background(), prefix)
+}
+
+func (qiniu *QiniuStorage) ListContext(ctx context.Context, prefix string) ([]os.FileInfo, error) {
+	var objects = make([]os.FileInfo, 0)
+
+	it := qiniu.ListObjects(ctx, ListOptions{Prefix: prefix, Recursive: true})
+	for it.Next() {
+		objects = append(objects, it.Object())
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	return objects, nil
+}
+
+// ListObjects 使用 ListFiles 与 marker 按页惰性列举文件, 七牛不支持 StartAfter,
+// 由客户端过滤
+func (qiniu *QiniuStorage) ListObjects(ctx context.Context, opts ListOptions) *ObjectIterator {
+	bucketManager := qiniu.bucketManager()
+
+	return newObjectIterator(ctx, opts, func(ctx context.Context, marker string) ([]os.FileInfo, string, error) {
+		entries, commonPrefixes, next, hasNext, err := bucketManager.ListFiles(qiniu.Config.Bucket, opts.Prefix, opts.delimiter(), marker, opts.pageSize())
+		if err != nil {
+			return nil, "", qiniuError("list", opts.Prefix, err)
+		}
+
+		var (
+			objects  = make([]os.FileInfo, 0, len(entries)+len(commonPrefixes))
+			prefixes = make([]string, 0, len(commonPrefixes))
+		)
+		for _, item := range entries {
+			if item.IsEmpty() || item.Key <= opts.StartAfter {
+				continue
+			}
+
+			objects = append(objects, &ObjectInfo{
+				key:   item.Key,
+				size:  item.Fsize,
+				time:  qiniuPutTime(item.PutTime),
+				isDir: strings.HasSuffix(item.Key, "/"),
+				meta: &ObjectMeta{
+					ContentType:  item.MimeType,
+					ETag:         item.Hash,
+					StorageClass: qiniuStorageClass(item.Type),
+				},
+			})
+		}
+		for _, prefix := range commonPrefixes {
+			if prefix > opts.StartAfter {
+				prefixes = append(prefixes, prefix)
+			}
+		}
+		if !hasNext {
+			next = ""
+		}
+		return mergePage(objects, prefixes), next, nil
+	})
+}
+
+func (qiniu *QiniuStorage) Get(key string) ([]byte, error) {
+	return qiniu.GetContext(context.Background(), key)
+}
+
+func (qiniu *QiniuStorage) GetContext(ctx context.Context, key string) ([]byte, error) {
+	body, err := qiniu.OpenContext(ctx, key)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	log.Debugf("upload to bucket %s -> %s", bucket, ret.Key)
-	return nil
+	defer body.Close()
+
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, qiniuError("get", key, err)
+	}
+	return b, nil
+}
+
+func (qiniu *QiniuStorage) Open(key string) (io.ReadCloser, error) {
+	return qiniu.OpenContext(context.Background(), key)
+}
+
+// OpenContext 通过配置的域名下载文件, 私有空间使用带签名的链接
+func (qiniu *QiniuStorage) OpenContext(ctx context.Context, key string) (io.ReadCloser, error) {
+	return qiniu.OpenRange(ctx, key, 0, -1)
+}
+
+func (qiniu *QiniuStorage) GetRange(key string, offset, length int64) ([]byte, error) {
+	return getRange(qiniu, key, offset, length)
+}
+
+// OpenRange 下载时带上 Range 请求头, 读取文件的部分内容
+func (qiniu *QiniuStorage) OpenRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	if err := checkRange(key, offset); err != nil {
+		return nil, err
+	}
+	if length == 0 {
+		return emptyBody(), nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, qiniu.downloadURL(key, qiniuDownloadExpiry), nil)
+	if err != nil {
+		return nil, newError("open", key, ErrInvalid, err)
+	}
+
+	if h := rangeHeader(offset, length); h != "" {
+		req.Header.Set("Range", h)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, qiniuError("open", key, err)
+	}
+	return httpRangeBody("open", key, resp, offset, length)
+}
+
+// downloadURL 生成文件的下载链接
+func (qiniu *QiniuStorage) downloadURL(key string, expiry time.Duration) string {
+	domain := qiniu.Config.HttpPrefix
+	if !strings.HasPrefix(domain, "http://") && !strings.HasPrefix(domain, "https://") {
+		domain = "http://" + domain
+	}
+
+	if qiniu.Config.Private {
+		return storage.MakePrivateURLv2(qiniu.mac, domain, key, time.Now().Add(expiry).Unix())
+	}
+	return storage.MakePublicURLv2(domain, key)
+}
+
+// PutFile 上传一个文件
+func (qiniu *QiniuStorage) PutFile(key string, localfile string) error {
+	return qiniu.PutFileContext(context.Background(), key, localfile)
+}
+
+func (qiniu *QiniuStorage) PutFileContext(ctx context.Context, key string, localfile string) error {
+	return putFile(ctx, qiniu, key, localfile)
 }
 
-// PutFile 上传一段 Bytes 数据流
+// Put 上传一段 Bytes 数据流
 func (qiniu *QiniuStorage) Put(key string, b []byte) error {
-	bucket := qiniu.Config.Bucket
+	return qiniu.PutContext(context.Background(), key, b)
+}
 
-	putPolicy := storage.PutPolicy{
-		Scope: bucket,
+func (qiniu *QiniuStorage) PutContext(ctx context.Context, key string, b []byte) error {
+	return qiniu.PutReaderContext(ctx, key, bytes.NewReader(b), int64(len(b)))
+}
+
+// PutReader 以流的方式上传, size 为 -1 时表示长度未知
+func (qiniu *QiniuStorage) PutReader(key string, r io.Reader, size int64) error {
+	return qiniu.PutReaderContext(context.Background(), key, r, size)
+}
+
+func (qiniu *QiniuStorage) PutReaderContext(ctx context.Context, key string, r io.Reader, size int64) error {
+	return qiniu.PutObjectContext(ctx, key, r, size, PutOptions{})
+}
+
+func (qiniu *QiniuStorage) PutObject(key string, r io.Reader, size int64, opts PutOptions) error {
+	return qiniu.PutObjectContext(context.Background(), key, r, size, opts)
+}
+
+// PutObjectContext 长度已知时使用表单上传, 长度未知时使用分片上传 v2 流式上传,
+// 避免表单上传把数据整体读入内存. 七牛上传时只支持 ContentType、Metadata 与
+// StorageClass (STANDARD、LINE、ARCHIVE、DEEP_ARCHIVE), 其它选项被忽略
+func (qiniu *QiniuStorage) PutObjectContext(ctx context.Context, key string, r io.Reader, size int64, opts PutOptions) error {
+	fileType, ok := qiniuFileType(opts.StorageClass)
+	if !ok {
+		return newError("put", key, ErrInvalid, fmt.Errorf("qiniu: unknown storage class %q", opts.StorageClass))
 	}
 
-	upToken := putPolicy.UploadToken(qiniu.mac)
-	cfg := storage.Config{}
-	// 空间对应的机房
+	r, err := opts.detect(key, r)
+	if err != nil {
+		return err
+	}
 
-	if region, ok := qiniuRegionMap[qiniu.Config.Region]; ok {
-		cfg.Zone = &region
-	} else {
-		cfg.Zone = &storage.ZoneHuadong
+	var (
+		ret   = storage.PutRet{}
+		token = qiniu.putToken(fileType)
+		meta  = make(map[string]string, len(opts.Metadata))
+	)
+
+	for k, v := range opts.Metadata {
+		meta[qiniuMetaPrefix+k] = v
 	}
-	// 是否使用https域名
-	cfg.UseHTTPS = false
-	// 上传是否使用CDN上传加速
-	cfg.UseCdnDomains = false
+
+	if size < 0 {
+		resumeUploader := storage.NewResumeUploaderV2(qiniu.config())
+		err := resumeUploader.PutWithoutSize(ctx, &ret, token, key, r, &storage.RputV2Extra{
+			MimeType: opts.ContentType,
+			Metadata: meta,
+		})
+		if err != nil {
+			return qiniuError("put", key, err)
+		}
+		log.Debugf("upload to bucket %s -> %s", qiniu.Config.Bucket, ret.Key)
+		return nil
+	}
+
 	// 构建表单上传的对象
-	formUploader := storage.NewFormUploader(&cfg)
-	ret := storage.PutRet{}
-	// 可选配置
+	formUploader := storage.NewFormUploader(qiniu.config())
 	putExtra := storage.PutExtra{
-		Params: nil,
+		Params:   meta,
+		MimeType: opts.ContentType,
 	}
 
-	var rd = bytes.NewReader(b)
-	err := formUploader.Put(context.Background(), &ret, upToken, key, rd, int64(len(b)), &putExtra)
+	err = formUploader.Put(ctx, &ret, token, key, r, size, &putExtra)
 	if err != nil {
-		return err
+		return qiniuError("put", key, err)
 	}
-	log.Debugf("upload to bucket %s -> %s", bucket, ret.Key)
+	log.Debugf("upload to bucket %s -> %s", qiniu.Config.Bucket, ret.Key)
 	return nil
 }
 
 // Move 移动目标到指定位置
 func (qiniu *QiniuStorage) Move(dest string, from string) error {
+	return qiniu.MoveContext(context.Background(), dest, from)
+}
+
+// MoveContext BucketManager 不支持 context, 只在请求前检查 ctx
+func (qiniu *QiniuStorage) MoveContext(ctx context.Context, dest string, from string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	bucket := qiniu.Config.Bucket
-	cfg := storage.Config{}
-	// 空间对应的机房
+	return qiniuError("move", from, qiniu.bucketManager().Move(bucket, from, bucket, dest, true))
+}
 
-	if region, ok := qiniuRegionMap[qiniu.Config.Region]; ok {
-		cfg.Zone = &region
-	} else {
-		cfg.Zone = &storage.ZoneHuadong
+func (qiniu *QiniuStorage) Copy(dest string, from string, opts ...CopyOptionFunc) error {
+	return qiniu.CopyContext(context.Background(), dest, from, opts...)
+}
+
+// CopyContext 使用 BucketManager.Copy 服务端复制, 覆盖已存在的文件; 七牛只支持
+// 修改 Content-Type, 不支持替换自定义元数据
+func (qiniu *QiniuStorage) CopyContext(ctx context.Context, dest string, from string, opts ...CopyOptionFunc) error {
+	var copts = newCopyOptions(qiniu.Config.Bucket, opts)
+	if copts.Metadata != nil {
+		return newError("copy", from, ErrNotImplemented, errors.New("qiniu: metadata replacement is not supported"))
 	}
-	// 是否使用https域名
-	cfg.UseHTTPS = false
-	// 上传是否使用CDN上传加速
-	cfg.UseCdnDomains = false
-	bucketManager := storage.NewBucketManager(qiniu.mac, &cfg)
 
-	return bucketManager.Move(bucket, from, bucket, dest, true)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	bucket := qiniu.Config.Bucket
+	manager := qiniu.bucketManager()
+	if err := manager.Copy(copts.SourceBucket, from, bucket, dest, true); err != nil {
+		return qiniuError("copy", from, err)
+	}
+
+	if copts.ContentType != "" {
+		return qiniuError("copy", dest, manager.ChangeMime(bucket, dest, copts.ContentType))
+	}
+	return nil
+}
+
+// sameBackend 同一个账号下的存储空间之间可以服务端复制
+func (qiniu *QiniuStorage) sameBackend(src Storage) bool {
+	other, ok := src.(*QiniuStorage)
+	return ok && other.Config.AppKey == qiniu.Config.AppKey
 }
 
 // Exist 存储空间存在一个文件
 func (qiniu *QiniuStorage) Exist(key string) bool {
-	bucket := qiniu.Config.Bucket
-	cfg := storage.Config{}
-	// 空间对应的机房
+	return qiniu.ExistContext(context.Background(), key)
+}
 
-	if region, ok := qiniuRegionMap[qiniu.Config.Region]; ok {
-		cfg.Zone = &region
-	} else {
-		cfg.Zone = &storage.ZoneHuadong
-	}
-	// 是否使用https域名
-	cfg.UseHTTPS = false
-	// 上传是否使用CDN上传加速
-	cfg.UseCdnDomains = false
-	bucketManager := storage.NewBucketManager(qiniu.mac, &cfg)
-	fileInfo, err := bucketManager.Stat(bucket, key)
+func (qiniu *QiniuStorage) ExistContext(ctx context.Context, key string) bool {
+	fileInfo, err := qiniu.StatContext(ctx, key)
 	if err != nil {
 		return false
 	}
-	return fileInfo.Fsize > 0
+	return fileInfo.Size() > 0
+}
+
+// Stat 获取文件的元数据, 七牛不返回用户自定义元数据
+func (qiniu *QiniuStorage) Stat(key string) (os.FileInfo, error) {
+	return qiniu.StatContext(context.Background(), key)
+}
+
+// StatContext BucketManager 不支持 context, 只在请求前检查 ctx
+func (qiniu *QiniuStorage) StatContext(ctx context.Context, key string) (os.FileInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	fileInfo, err := qiniu.bucketManager().Stat(qiniu.Config.Bucket, key)
+	if err != nil {
+		return nil, qiniuError("stat", key, err)
+	}
+
+	return qiniuStatInfo(key, fileInfo.Fsize, fileInfo.Hash, fileInfo.MimeType, fileInfo.PutTime, fileInfo.Type), nil
+}
+
+func qiniuStatInfo(key string, fsize int64, hash, mimeType string, putTime int64, typ int) *ObjectInfo {
+	return &ObjectInfo{
+		key:   key,
+		size:  fsize,
+		time:  qiniuPutTime(putTime),
+		isDir: strings.HasSuffix(key, "/"),
+		meta: &ObjectMeta{
+			ContentType:  mimeType,
+			ETag:         hash,
+			StorageClass: qiniuStorageClass(typ),
+		},
+	}
 }
 
 func (qiniu *QiniuStorage) Remove(key string) error {
-	bucket := qiniu.Config.Bucket
-	cfg := storage.Config{}
-	// 空间对应的机房
+	return qiniu.RemoveContext(context.Background(), key)
+}
 
-	if region, ok := qiniuRegionMap[qiniu.Config.Region]; ok {
-		cfg.Zone = &region
-	} else {
-		cfg.Zone = &storage.ZoneHuadong
+func (qiniu *QiniuStorage) RemoveContext(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return qiniuError("remove", key, qiniu.bucketManager().Delete(qiniu.Config.Bucket, key))
+}
+
+// RemoveMany 使用 BucketManager.Batch 批量删除, 每 1000 个 key 发送一次请求
+func (qiniu *QiniuStorage) RemoveMany(ctx context.Context, keys []string) ([]BatchResult, error) {
+	return qiniu.batch(ctx, "remove", keys, storage.URIDelete)
+}
+
+// RemovePrefix 删除 prefix 下的所有对象
+func (qiniu *QiniuStorage) RemovePrefix(ctx context.Context, prefix string) ([]BatchResult, error) {
+	return removePrefix(ctx, qiniu, prefix)
+}
+
+// StatMany 使用 BucketManager.Batch 批量获取元数据
+func (qiniu *QiniuStorage) StatMany(ctx context.Context, keys []string) ([]BatchResult, error) {
+	return qiniu.batch(ctx, "stat", keys, storage.URIStat)
+}
+
+// batch 将 keys 按 1000 个一组发送批量请求; BucketManager 不支持 context,
+// 只在每次请求前检查 ctx. 与其它存储一致, 批量删除不存在的文件不视为错误
+func (qiniu *QiniuStorage) batch(ctx context.Context, op string, keys []string, uri func(bucket, key string) string) ([]BatchResult, error) {
+	var (
+		bucket  = qiniu.Config.Bucket
+		manager = qiniu.bucketManager()
+		results = make([]BatchResult, 0, len(keys))
+	)
+
+	for _, chunk := range batchChunks(keys) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		var ops = make([]string, len(chunk))
+		for i, key := range chunk {
+			ops[i] = uri(bucket, key)
+		}
+
+		rets, err := manager.Batch(ops)
+		if err != nil {
+			return nil, qiniuError(op, "", err)
+		}
+		if len(rets) != len(chunk) {
+			return nil, newError(op, "", ErrUnavailable, fmt.Errorf("qiniu: batch returned %d results for %d keys", len(rets), len(chunk)))
+		}
+
+		for i, ret := range rets {
+			var result = BatchResult{Key: chunk[i]}
+			switch {
+			case ret.Code == http.StatusOK && op == "stat":
+				result.Info = qiniuStatInfo(chunk[i], ret.Data.Fsize, ret.Data.Hash, ret.Data.MimeType, ret.Data.PutTime, ret.Data.Type)
+			case ret.Code == http.StatusOK, ret.Code == 612 && op == "remove":
+			default:
+				result.Err = qiniuError(op, chunk[i], &client.ErrorInfo{Code: ret.Code, Err: ret.Data.Error})
+			}
+			results = append(results, result)
+		}
+	}
+	return results, nil
+}
+
+// PutMultipart 使用 ResumeUploaderV2 分片上传大文件, StateFile 保存七牛 SDK 的上传进度;
+// 七牛 SDK 的并发数为全局设置 (storage.SetSettings), 不能按次指定, 设置了 Concurrency
+// 时返回 ErrInvalid
+func (qiniu *QiniuStorage) PutMultipart(ctx context.Context, key string, r io.ReaderAt, size int64, opts MultipartOptions) error {
+	if opts.Concurrency != 0 {
+		return newError("put", key, ErrInvalid, errors.New("qiniu: concurrency is set globally by storage.SetSettings"))
 	}
-	// 是否使用https域名
-	cfg.UseHTTPS = false
-	// 上传是否使用CDN上传加速
-	cfg.UseCdnDomains = false
-	bucketManager := storage.NewBucketManager(qiniu.mac, &cfg)
 
-	return bucketManager.Delete(bucket, key)
+	var extra = storage.RputV2Extra{PartSize: opts.partSize(size)}
+	if opts.StateFile != "" {
+		extra.Recorder = qiniuStateRecorder(opts.StateFile)
+	}
+
+	ret := storage.PutRet{}
+	resumeUploader := storage.NewResumeUploaderV2(qiniu.config())
+	if err := resumeUploader.Put(ctx, &ret, qiniu.upToken(), key, r, size, &extra); err != nil {
+		return qiniuError("put", key, err)
+	}
+	log.Debugf("upload to bucket %s -> %s", qiniu.Config.Bucket, ret.Key)
+	return nil
+}
+
+// AbortStaleUploads 七牛不支持列举未完成的分片上传, 未完成的上传会由七牛自动清理
+func (qiniu *QiniuStorage) AbortStaleUploads(ctx context.Context, prefix string, olderThan time.Duration) (int, error) {
+	return 0, newError("abort", prefix, ErrNotImplemented, nil)
+}
+
+// qiniuStateRecorder 将七牛 SDK 的上传进度保存在指定的文件中, 忽略 SDK 生成的 key,
+// SDK 生成的 key 包含每次都不同的上传凭证, 使用 FileRecorder 无法续传
+type qiniuStateRecorder string
+
+func (file qiniuStateRecorder) Set(key string, data []byte) error {
+	tmp := string(file) + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, string(file))
+}
+
+func (file qiniuStateRecorder) Get(key string) ([]byte, error) {
+	return ioutil.ReadFile(string(file))
+}
+
+func (file qiniuStateRecorder) Delete(key string) error {
+	err := os.Remove(string(file))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (file qiniuStateRecorder) GenerateRecorderKey(keyInfos []string, sourceFileInfo os.FileInfo) string {
+	return string(file)
+}
+
+// SignedURL 生成下载地址, 私有空间使用 MakePrivateURLv2 签名; 七牛不支持预签名的
+// PUT 地址, 浏览器上传需要使用 UploadToken 生成的上传凭证, 返回 ErrNotImplemented
+func (qiniu *QiniuStorage) SignedURL(key, method string, expiry time.Duration, opts *SignOptions) (string, error) {
+	method, err := signMethod(key, method, expiry)
+	if err != nil {
+		return "", err
+	}
+
+	if method == http.MethodPut {
+		return "", newError("sign", key, ErrNotImplemented, errors.New("qiniu: use UploadToken for direct uploads"))
+	}
+
+	var u = qiniu.downloadURL(key, expiry)
+	if opts != nil && opts.ContentDisposition != "" {
+		// 七牛通过 attname 参数设置下载的文件名
+		if _, params, err := mime.ParseMediaType(opts.ContentDisposition); err == nil && params["filename"] != "" {
+			if strings.Contains(u, "?") {
+				u += "&attname=" + url.QueryEscape(params["filename"])
+			} else {
+				u += "?attname=" + url.QueryEscape(params["filename"])
+			}
+		}
+	}
+	return u, nil
+}
+
+// UploadToken 生成只能上传 key 的凭证, 供客户端直传使用, 凭证允许覆盖已存在的文件
+func (qiniu *QiniuStorage) UploadToken(key string, expiry time.Duration) string {
+	putPolicy := storage.PutPolicy{
+		Scope:   qiniu.Config.Bucket + ":" + key,
+		Expires: qiniuExpires(expiry),
+	}
+	return putPolicy.UploadToken(qiniu.mac)
+}
+
+// UploadPolicy 生成表单直传策略, 上传凭证限制 key 前缀、大小与类型, 并带上配置的回调;
+// 客户端没有指定 key 时以原文件名保存在 keyPrefix 下
+func (qiniu *QiniuStorage) UploadPolicy(keyPrefix string, maxSize int64, contentTypes []string, expiry time.Duration) (*PostPolicy, error) {
+	if err := checkPolicy(keyPrefix, maxSize, expiry); err != nil {
+		return nil, err
+	}
+
+	putPolicy := storage.PutPolicy{
+		Scope:            qiniu.Config.Bucket,
+		Expires:          qiniuExpires(expiry),
+		SaveKey:          keyPrefix + "$(fname)",
+		FsizeLimit:       maxSize,
+		MimeLimit:        strings.Join(contentTypes, ";"),
+		CallbackURL:      qiniu.Config.CallbackURL,
+		CallbackBody:     qiniu.Config.CallbackBody,
+		CallbackBodyType: qiniu.Config.CallbackBodyType,
+	}
+
+	if keyPrefix != "" {
+		putPolicy.Scope += ":" + keyPrefix
+		putPolicy.IsPrefixalScope = 1
+	}
+
+	var upHost = "upload.qiniup.com"
+	if hosts := qiniu.config().Zone.SrcUpHosts; len(hosts) > 0 {
+		upHost = hosts[0]
+	}
+
+	return &PostPolicy{
+		URL:       "http://" + upHost,
+		Fields:    map[string]string{"token": putPolicy.UploadToken(qiniu.mac)},
+		FileField: "file",
+		Expires:   time.Now().Add(expiry),
+	}, nil
+}
+
+// qiniuExpires 将有效期转换为秒, 不足一秒按一秒计算, 避免为 0 时 SDK 使用默认的一小时
+func qiniuExpires(expiry time.Duration) uint64 {
+	return uint64((expiry + time.Second - 1) / time.Second)
 }
 
 func (qiniu *QiniuStorage) WebURL(key string) (string, error) {
@@ -213,4 +631,79 @@ func (qiniu *QiniuStorage) BucketURI(key string) BucketURI {
 	return BucketURI(fmt.Sprintf("%s://%s/%s", "qiniu", qiniu.Config.Bucket, key))
 }
 
-var _ Storage = &QiniuStorage{}
+// qiniuPutTime 七牛的上传时间单位为 100 纳秒
+func qiniuPutTime(putTime int64) time.Time {
+	return time.Unix(0, putTime*100)
+}
+
+// qiniuStorageClass 将七牛的存储类型转换为存储类别名称
+func qiniuStorageClass(fileType int) string {
+	switch fileType {
+	case 1:
+		return "LINE"
+	case 2:
+		return "ARCHIVE"
+	case 3:
+		return "DEEP_ARCHIVE"
+	default:
+		return "STANDARD"
+	}
+}
+
+// qiniuMetaPrefix 七牛自定义元数据的前缀
+const qiniuMetaPrefix = "x-qn-meta-"
+
+// qiniuFileType qiniuStorageClass 的逆映射, 空字符串为标准存储
+func qiniuFileType(class string) (int, bool) {
+	switch class {
+	case "", "STANDARD":
+		return 0, true
+	case "LINE":
+		return 1, true
+	case "ARCHIVE":
+		return 2, true
+	case "DEEP_ARCHIVE":
+		return 3, true
+	default:
+		return 0, false
+	}
+}
+
+// qiniuError 将七牛的错误码映射为 storage 错误
+func qiniuError(op, key string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var info *client.ErrorInfo
+	if !errors.As(err, &info) {
+		return newError(op, key, nil, err)
+	}
+
+	var kind error
+	switch info.Code {
+	case 612, 631: // 文件或空间不存在
+		kind = ErrNotExist
+	case 614: // 文件已存在
+		kind = ErrExist
+	case 573: // 请求频率过高
+		kind = ErrThrottled
+	case 579, 599: // 回调失败、服务端错误
+		kind = ErrUnavailable
+	default:
+		kind = kindOfStatus(info.Code)
+	}
+	return newError(op, key, kind, err)
+}
+
+var (
+	_ StorageContext    = &QiniuStorage{}
+	_ Lister            = &QiniuStorage{}
+	_ Signer            = &QiniuStorage{}
+	_ PolicySigner      = &QiniuStorage{}
+	_ MultipartUploader = &QiniuStorage{}
+	_ RangeReader       = &QiniuStorage{}
+	_ Copier            = &QiniuStorage{}
+	_ Batcher           = &QiniuStorage{}
+	_ Putter            = &QiniuStorage{}
+)
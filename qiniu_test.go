@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQiniuStorage_Get(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/images/hello.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("hello world"))
+	}))
+	defer srv.Close()
+
+	store := NewQiniuStorage(&QiniuConfig{
+		AppKey:     "ak",
+		Secret:     "sk",
+		Bucket:     "test",
+		HttpPrefix: srv.URL,
+	})
+
+	content, err := store.Get("images/hello.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world", string(content))
+
+	_, err = store.Get("images/missing.txt")
+	assert.True(t, errors.Is(err, ErrNotExist))
+}
+
+func TestQiniuStorage_downloadURL(t *testing.T) {
+	store := NewQiniuStorage(&QiniuConfig{
+		AppKey:     "ak",
+		Secret:     "sk",
+		Bucket:     "test",
+		HttpPrefix: "cdn.example.com",
+	})
+	assert.Equal(t, "http://cdn.example.com/a%20b.txt", store.downloadURL("a b.txt", qiniuDownloadExpiry))
+
+	store.Config.Private = true
+	assert.Regexp(t, `^http://cdn\.example\.com/a\.txt\?e=\d+&token=ak:`, store.downloadURL("a.txt", qiniuDownloadExpiry))
+}
+
+func TestQiniuStorage_PutMultipart(t *testing.T) {
+	store := NewQiniuStorage(&QiniuConfig{AppKey: "ak", Secret: "sk", Bucket: "test"})
+
+	// 七牛 SDK 的并发数不能按次指定
+	err := store.PutMultipart(context.Background(), "a.bin", strings.NewReader("hello"), 5, MultipartOptions{Concurrency: 8})
+	assert.True(t, errors.Is(err, ErrInvalid))
+}
@@ -0,0 +1,290 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+)
+
+// RangeReader 支持读取对象部分内容的存储
+//
+// offset 为起始位置, length 为读取的字节数, length < 0 时读取到对象结尾;
+// 超出对象大小的范围返回 ErrInvalid
+type RangeReader interface {
+	GetRange(key string, offset, length int64) ([]byte, error)
+	OpenRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+}
+
+// GetRange 读取对象的部分内容, store 未实现 RangeReader 时读取完整对象后截取
+func GetRange(ctx context.Context, store Storage, key string, offset, length int64) ([]byte, error) {
+	body, err := OpenRange(ctx, store, key, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, newError("get", key, nil, err)
+	}
+	return b, nil
+}
+
+// OpenRange 打开对象的部分内容, store 未实现 RangeReader 时跳过 offset 之前的内容
+func OpenRange(ctx context.Context, store Storage, key string, offset, length int64) (io.ReadCloser, error) {
+	if rr, ok := store.(RangeReader); ok {
+		return rr.OpenRange(ctx, key, offset, length)
+	}
+
+	if err := checkRange(key, offset); err != nil {
+		return nil, err
+	}
+
+	body, err := AdaptContext(store).OpenContext(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = io.CopyN(ioutil.Discard, body, offset); err != nil {
+		body.Close()
+		if err == io.EOF {
+			return nil, newError("open", key, ErrInvalid, fmt.Errorf("offset %d out of range", offset))
+		}
+		return nil, newError("open", key, nil, err)
+	}
+	return limitBody(body, length), nil
+}
+
+// getRange 使用 OpenRange 实现 RangeReader 的 GetRange
+func getRange(rr RangeReader, key string, offset, length int64) ([]byte, error) {
+	body, err := rr.OpenRange(context.Background(), key, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, newError("get", key, nil, err)
+	}
+	return b, nil
+}
+
+func checkRange(key string, offset int64) error {
+	if offset < 0 {
+		return newError("open", key, ErrInvalid, fmt.Errorf("negative offset %d", offset))
+	}
+	return nil
+}
+
+// rangeHeader 返回 HTTP Range 请求头, 读取整个对象时返回空
+func rangeHeader(offset, length int64) string {
+	switch {
+	case length < 0 && offset == 0:
+		return ""
+	case length < 0:
+		return fmt.Sprintf("bytes=%d-", offset)
+	default:
+		return fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+	}
+}
+
+// readCloser 组合 Reader 与原始的 Closer
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// limitBody 限制最多读取 length 字节, length < 0 不限制
+func limitBody(body io.ReadCloser, length int64) io.ReadCloser {
+	if length < 0 {
+		return body
+	}
+	return &readCloser{Reader: io.LimitReader(body, length), Closer: body}
+}
+
+// ctxBody ctx 结束时关闭 body, 使阻塞的 Read 返回
+type ctxBody struct {
+	io.ReadCloser
+	done chan struct{}
+	once sync.Once
+}
+
+// contextBody 用于不支持 ctx 的客户端返回的读取流
+func contextBody(ctx context.Context, body io.ReadCloser) io.ReadCloser {
+	if ctx.Done() == nil {
+		return body
+	}
+
+	var b = &ctxBody{ReadCloser: body, done: make(chan struct{})}
+	go func() {
+		select {
+		case <-ctx.Done():
+			body.Close()
+		case <-b.done:
+		}
+	}()
+	return b
+}
+
+func (b *ctxBody) Close() error {
+	b.once.Do(func() { close(b.done) })
+	return b.ReadCloser.Close()
+}
+
+// emptyBody 长度为 0 的范围不需要请求后端
+func emptyBody() io.ReadCloser {
+	return ioutil.NopCloser(bytes.NewReader(nil))
+}
+
+// httpRangeBody 处理 Range 请求的响应, 服务端忽略 Range 返回 200 时在客户端截取
+func httpRangeBody(op, key string, resp *http.Response, offset, length int64) (io.ReadCloser, error) {
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		return limitBody(resp.Body, length), nil
+	case http.StatusOK:
+		if _, err := io.CopyN(ioutil.Discard, resp.Body, offset); err != nil {
+			resp.Body.Close()
+			if err == io.EOF {
+				return nil, newError(op, key, ErrInvalid, fmt.Errorf("offset %d out of range", offset))
+			}
+			return nil, newError(op, key, nil, err)
+		}
+		return limitBody(resp.Body, length), nil
+	default:
+		resp.Body.Close()
+		return nil, statusError(op, key, resp)
+	}
+}
+
+// ObjectReader 对象的随机读取句柄, 实现 io.ReaderAt 与 io.ReadSeeker
+//
+// Read 在当前位置保持一个流式的连接, Seek 之后在下一次 Read 时重新打开;
+// ReadAt 每次按范围单独请求, 可以并发调用, 适合读取 zip 的中央目录等场景
+type ObjectReader struct {
+	ctx   context.Context
+	store Storage
+	key   string
+	size  int64
+
+	mu     sync.Mutex
+	offset int64
+	body   io.ReadCloser
+	pos    int64
+}
+
+// OpenObject 打开对象的随机读取句柄, 通过 Stat 获取对象大小
+func OpenObject(ctx context.Context, store Storage, key string) (*ObjectReader, error) {
+	info, err := AdaptContext(store).StatContext(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return &ObjectReader{ctx: ctx, store: store, key: key, size: info.Size()}, nil
+}
+
+// Size 返回对象大小
+func (r *ObjectReader) Size() int64 {
+	return r.size
+}
+
+func (r *ObjectReader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+
+	if r.body == nil || r.pos != r.offset {
+		if r.body != nil {
+			r.body.Close()
+		}
+
+		body, err := OpenRange(r.ctx, r.store, r.key, r.offset, -1)
+		if err != nil {
+			r.body = nil
+			return 0, err
+		}
+		r.body, r.pos = body, r.offset
+	}
+
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	r.pos += int64(n)
+	if err == io.EOF && r.offset < r.size {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (r *ObjectReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, newError("read", r.key, ErrInvalid, fmt.Errorf("negative offset %d", off))
+	}
+	if off >= r.size {
+		return 0, io.EOF
+	}
+
+	var length = int64(len(p))
+	if off+length > r.size {
+		length = r.size - off
+	}
+
+	body, err := OpenRange(r.ctx, r.store, r.key, off, length)
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+
+	n, err := io.ReadFull(body, p[:length])
+	if err == nil && length < int64(len(p)) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (r *ObjectReader) Seek(offset int64, whence int) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, newError("seek", r.key, ErrInvalid, errors.New("invalid whence"))
+	}
+
+	if offset < 0 {
+		return 0, newError("seek", r.key, ErrInvalid, errors.New("negative position"))
+	}
+
+	r.offset = offset
+	return offset, nil
+}
+
+func (r *ObjectReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.body == nil {
+		return nil
+	}
+
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
+
+var (
+	_ io.ReaderAt   = &ObjectReader{}
+	_ io.ReadSeeker = &ObjectReader{}
+	_ io.Closer     = &ObjectReader{}
+)
@@ -0,0 +1,246 @@
+package storage
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/stretchr/testify/assert"
+)
+
+// plainStorage 隐藏 RangeReader, 用于测试通用的实现
+type plainStorage struct {
+	Storage
+}
+
+func rangeStores(t *testing.T) map[string]Storage {
+	mem, err := NewMemory("range", MemoryRegistry(NewRegistry()))
+	assert.NoError(t, err)
+
+	local, err := NewLocal(t.TempDir(), LocalRegistry(NewRegistry()))
+	assert.NoError(t, err)
+
+	plain, err := NewMemory("range-plain", MemoryRegistry(NewRegistry()))
+	assert.NoError(t, err)
+
+	return map[string]Storage{"mem": mem, "file": local, "plain": plainStorage{plain}}
+}
+
+func TestGetRange(t *testing.T) {
+	for name, store := range rangeStores(t) {
+		t.Run(name, func(t *testing.T) {
+			assert.NoError(t, store.Put("a.txt", []byte("0123456789")))
+
+			tests := []struct {
+				offset, length int64
+				want           string
+			}{
+				{0, -1, "0123456789"},
+				{2, 3, "234"},
+				{7, -1, "789"},
+				{7, 100, "789"},
+				{10, -1, ""},
+				{3, 0, ""},
+			}
+
+			for _, tt := range tests {
+				b, err := GetRange(context.Background(), store, "a.txt", tt.offset, tt.length)
+				assert.NoError(t, err)
+				assert.Equal(t, tt.want, string(b), "offset %d length %d", tt.offset, tt.length)
+			}
+
+			_, err := GetRange(context.Background(), store, "a.txt", 11, 1)
+			assert.True(t, errors.Is(err, ErrInvalid))
+			_, err = GetRange(context.Background(), store, "a.txt", -1, 1)
+			assert.True(t, errors.Is(err, ErrInvalid))
+			_, err = GetRange(context.Background(), store, "missing.txt", 0, 1)
+			assert.True(t, errors.Is(err, ErrNotExist))
+		})
+	}
+}
+
+func TestObjectReader(t *testing.T) {
+	for name, store := range rangeStores(t) {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			zw := zip.NewWriter(&buf)
+			for _, name := range []string{"a.txt", "b.txt"} {
+				w, err := zw.Create(name)
+				assert.NoError(t, err)
+				w.Write([]byte(strings.Repeat(name, 100)))
+			}
+			assert.NoError(t, zw.Close())
+			assert.NoError(t, store.Put("a.zip", buf.Bytes()))
+
+			r, err := OpenObject(context.Background(), store, "a.zip")
+			assert.NoError(t, err)
+			defer r.Close()
+			assert.Equal(t, int64(buf.Len()), r.Size())
+
+			// 通过 ReaderAt 读取 zip 的中央目录
+			zr, err := zip.NewReader(r, r.Size())
+			assert.NoError(t, err)
+			assert.Len(t, zr.File, 2)
+			f, err := zr.File[1].Open()
+			assert.NoError(t, err)
+			content, err := ioutil.ReadAll(f)
+			assert.NoError(t, err)
+			assert.Equal(t, strings.Repeat("b.txt", 100), string(content))
+
+			all, err := ioutil.ReadAll(r)
+			assert.NoError(t, err)
+			assert.Equal(t, buf.Bytes(), all)
+
+			pos, err := r.Seek(-4, io.SeekEnd)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(buf.Len()-4), pos)
+			tail, err := ioutil.ReadAll(r)
+			assert.NoError(t, err)
+			assert.Equal(t, buf.Bytes()[buf.Len()-4:], tail)
+
+			p := make([]byte, 8)
+			n, err := r.ReadAt(p, int64(buf.Len()-2))
+			assert.Equal(t, io.EOF, err)
+			assert.Equal(t, 2, n)
+		})
+	}
+}
+
+func TestQiniuStorage_GetRange(t *testing.T) {
+	var content = strings.NewReader("0123456789")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/a.txt":
+			http.ServeContent(w, r, "a.txt", time.Time{}, content)
+		case "/norange.txt":
+			w.Write([]byte("0123456789"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	store := NewQiniuStorage(&QiniuConfig{
+		AppKey:     "ak",
+		Secret:     "sk",
+		Bucket:     "range-qiniu",
+		HttpPrefix: srv.URL,
+		Registry:   NewRegistry(),
+	})
+
+	for _, key := range []string{"a.txt", "norange.txt"} {
+		b, err := store.GetRange(key, 2, 3)
+		assert.NoError(t, err)
+		assert.Equal(t, "234", string(b))
+
+		b, err = store.GetRange(key, 7, -1)
+		assert.NoError(t, err)
+		assert.Equal(t, "789", string(b))
+	}
+
+	_, err := store.GetRange("a.txt", 20, 1)
+	assert.True(t, errors.Is(err, ErrInvalid))
+}
+
+// rangeServer 按 S3 协议提供 /<bucket>/a.txt, 记录每个请求的 Range
+type rangeServer struct {
+	mu     sync.Mutex
+	ranges []string
+}
+
+func (srv *rangeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	srv.mu.Lock()
+	srv.ranges = append(srv.ranges, r.Method+" "+r.Header.Get("Range"))
+	srv.mu.Unlock()
+
+	if !strings.HasSuffix(r.URL.Path, "/a.txt") {
+		w.Header().Set("Content-Type", "application/xml")
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`)
+		return
+	}
+
+	w.Header().Set("ETag", `"781e5e245d69b566979b86e28d23f2c7"`)
+	http.ServeContent(w, r, "a.txt", time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC), strings.NewReader("0123456789"))
+}
+
+func testRemoteRange(t *testing.T, store Storage, fake *rangeServer) {
+	tests := []struct {
+		offset, length int64
+		want, header   string
+	}{
+		{0, -1, "0123456789", ""},
+		{2, 3, "234", "bytes=2-4"},
+		{7, -1, "789", "bytes=7-"},
+		{7, 100, "789", "bytes=7-106"},
+	}
+
+	for _, tt := range tests {
+		fake.mu.Lock()
+		fake.ranges = nil
+		fake.mu.Unlock()
+
+		b, err := GetRange(context.Background(), store, "a.txt", tt.offset, tt.length)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.want, string(b), "offset %d length %d", tt.offset, tt.length)
+
+		// 只发送一次带 Range 的 GET
+		fake.mu.Lock()
+		assert.Equal(t, []string{"GET " + tt.header}, fake.ranges)
+		fake.mu.Unlock()
+	}
+
+	r, err := OpenObject(context.Background(), store, "a.txt")
+	assert.NoError(t, err)
+	var p = make([]byte, 4)
+	n, err := r.ReadAt(p, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, "3456", string(p[:n]))
+
+	_, err = GetRange(context.Background(), store, "missing.txt", 2, 3)
+	assert.True(t, errors.Is(err, ErrNotExist))
+}
+
+func TestMinioStorage_GetRange(t *testing.T) {
+	fake := &rangeServer{}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	store, err := NewMinio("key", "secret", "range-minio",
+		MinioEndpoint(srv.Listener.Addr().String()),
+		MinioRegion("us-east-1"),
+		MinioRegistry(NewRegistry()),
+	)
+	assert.NoError(t, err)
+	testRemoteRange(t, store, fake)
+}
+
+func TestS3ObjectStorage_GetRange(t *testing.T) {
+	fake := &rangeServer{}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:           aws.String("us-east-1"),
+		Endpoint:         aws.String(srv.URL),
+		S3ForcePathStyle: aws.Bool(true),
+		Credentials:      credentials.NewStaticCredentials("key", "secret", ""),
+	}))
+	store, err := NewS3("key", "secret", "range-s3", sess, S3Registry(NewRegistry()))
+	assert.NoError(t, err)
+	testRemoteRange(t, store, fake)
+}
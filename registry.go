@@ -0,0 +1,211 @@
+package storage
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Registry 记录已创建的存储及其对外访问的 host, 用于 BucketURI 与 http 地址之间的转换
+//
+// 同一个 scheme 与 bucket 只保留最后注册的存储
+type Registry struct {
+	mu      sync.RWMutex
+	entries map[registryKey]RegistryEntry
+}
+
+type registryKey struct {
+	scheme string
+	bucket string
+}
+
+// RegistryEntry 注册的存储
+type RegistryEntry struct {
+	Scheme string
+	Bucket string
+	Host   string
+	Store  Storage
+}
+
+// DefaultRegistry 默认的注册表, 构造函数没有指定注册表时注册到这里, BucketURI 的方法也使用它
+var DefaultRegistry = NewRegistry()
+
+func NewRegistry() *Registry {
+	return &Registry{entries: make(map[registryKey]RegistryEntry)}
+}
+
+// orDefault 为 nil 时返回 DefaultRegistry
+func (r *Registry) orDefault() *Registry {
+	if r == nil {
+		return DefaultRegistry
+	}
+	return r
+}
+
+// Register 注册存储, 已存在相同 scheme 与 bucket 的存储时替换
+func (r *Registry) Register(scheme string, store Storage, host string) {
+	var entry = RegistryEntry{
+		Scheme: scheme,
+		Bucket: store.BucketName(),
+		Host:   host,
+		Store:  store,
+	}
+
+	r.mu.Lock()
+	r.entries[registryKey{scheme, entry.Bucket}] = entry
+	r.mu.Unlock()
+}
+
+// Unregister 删除注册的存储
+func (r *Registry) Unregister(scheme string, bucket string) {
+	r.mu.Lock()
+	delete(r.entries, registryKey{scheme, bucket})
+	r.mu.Unlock()
+}
+
+// Lookup 查找 scheme 与 bucket 对应的存储
+func (r *Registry) Lookup(scheme string, bucket string) (RegistryEntry, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	entry, ok := r.entries[registryKey{scheme, bucket}]
+	return entry, ok
+}
+
+// List 按 scheme 与 bucket 排序返回所有注册的存储
+func (r *Registry) List() []RegistryEntry {
+	r.mu.RLock()
+	var list = make([]RegistryEntry, 0, len(r.entries))
+	for _, entry := range r.entries {
+		list = append(list, entry)
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Scheme != list[j].Scheme {
+			return list[i].Scheme < list[j].Scheme
+		}
+		return list[i].Bucket < list[j].Bucket
+	})
+	return list
+}
+
+// URL 返回 uri 对应的 http 地址, 存储未注册或没有 host 时原样返回
+func (r *Registry) URL(uri BucketURI) string {
+	scheme, bucket, key, err := uri.Parse()
+	if err != nil {
+		return string(uri)
+	}
+
+	entry, ok := r.Lookup(scheme, bucket)
+	if !ok || entry.Host == "" {
+		return string(uri)
+	}
+
+	// if isPrivatehost(host) {
+	// 	if !config.GetBool("cloudmode.private") {
+	// 		utils.ExternalIP()
+	// 	}
+	// }
+
+	switch scheme {
+	case "minio", "s3", "qiniu":
+		return fmt.Sprintf("http://%s/%s/%s", entry.Host, bucket, key)
+	case "file", "mem", "fastdfs":
+		// file 与 mem 的地址为 HttpPrefix 加 key, fastdfs 的地址由文件 ID 决定,
+		// 与存储的 WebURL 保持一致
+		if web, err := entry.Store.WebURL(key); err == nil {
+			return web
+		}
+		return string(uri)
+	default:
+		return string(uri)
+	}
+}
+
+// Resolve 查找 uri 对应的存储, 返回存储与对象的 key
+func (r *Registry) Resolve(uri BucketURI) (Storage, string, error) {
+	scheme, bucket, key, err := uri.Parse()
+	if err != nil {
+		return nil, "", err
+	}
+
+	entry, ok := r.Lookup(scheme, bucket)
+	if !ok {
+		return nil, "", newError("resolve", string(uri), ErrUnknownBucket, nil)
+	}
+	return entry.Store, key, nil
+}
+
+// ParseURL 将 URL 输出的 http 地址反查为 BucketURI, 其它形式或查不到时原样返回
+func (r *Registry) ParseURL(s string) BucketURI {
+	if !strings.HasPrefix(s, "http://") && !strings.HasPrefix(s, "https://") {
+		return BucketURI(s)
+	}
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return BucketURI(s)
+	}
+
+	for _, entry := range r.List() {
+		if entry.Host != u.Host {
+			continue
+		}
+
+		// fastdfs 的地址为文件 ID, 需要反查 key
+		if fastdfs, ok := entry.Store.(*FastdfsStorage); ok {
+			if key, ok := fastdfs.lookupKey(u.Path); ok {
+				return fastdfs.BucketURI(key)
+			}
+			continue
+		}
+
+		if prefix, ok := webPrefix(entry.Store); ok {
+			if key := strings.TrimPrefix(u.Path, prefix); key != u.Path {
+				return entry.Store.BucketURI(key)
+			}
+			continue
+		}
+
+		if key := strings.TrimPrefix(u.Path, "/"+entry.Bucket+"/"); key != u.Path {
+			return BucketURI(fmt.Sprintf("%s://%s/%s", entry.Scheme, entry.Bucket, key))
+		}
+	}
+	return BucketURI(s)
+}
+
+// webPrefix 返回 file 与 mem 存储 WebURL 中 key 之前的路径, 以 / 结尾
+func webPrefix(store Storage) (string, bool) {
+	var prefix string
+	switch store := store.(type) {
+	case *LocalStorage:
+		prefix = store.HttpPrefix
+	case *MemoryStorage:
+		prefix = store.HttpPrefix
+	default:
+		return "", false
+	}
+
+	u, err := url.Parse(prefix)
+	if err != nil {
+		return "", false
+	}
+	return strings.TrimRight(u.Path, "/") + "/", true
+}
+
+// register 将构造函数创建的存储注册到 r, r 为 nil 时注册到 DefaultRegistry
+func register(r *Registry, scheme string, store Storage, host string) {
+	r.orDefault().Register(scheme, store, host)
+}
+
+// GetBucketHost 返回 DefaultRegistry 中存储的 host
+func GetBucketHost(scheme string, bucket string) (string, bool) {
+	entry, ok := DefaultRegistry.Lookup(scheme, bucket)
+	if !ok {
+		return "", false
+	}
+	return entry.Host, true
+}
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+
+	first, err := NewMemory("images", MemoryRegistry(registry), MemoryWebPrefix("http://a.example.com"))
+	assert.NoError(t, err)
+	second, err := NewMemory("images", MemoryRegistry(registry), MemoryWebPrefix("http://b.example.com"))
+	assert.NoError(t, err)
+	_, err = NewLocal(t.TempDir(), LocalBucket("files"), LocalRegistry(registry))
+	assert.NoError(t, err)
+
+	// 相同的 scheme 与 bucket 只保留最后注册的存储
+	entry, ok := registry.Lookup("mem", "images")
+	assert.True(t, ok)
+	assert.Equal(t, Storage(second), entry.Store)
+	assert.Equal(t, "b.example.com", entry.Host)
+	assert.NotEqual(t, Storage(first), entry.Store)
+
+	var list []string
+	for _, entry := range registry.List() {
+		list = append(list, entry.Scheme+"://"+entry.Bucket)
+	}
+	assert.Equal(t, []string{"file://files", "mem://images"}, list)
+
+	uri := second.BucketURI("a.png")
+	assert.Equal(t, "http://b.example.com/a.png", registry.URL(uri))
+	assert.Equal(t, uri, registry.ParseURL("http://b.example.com/a.png"))
+
+	// 没有注册到 DefaultRegistry
+	_, ok = DefaultRegistry.Lookup("file", "files")
+	assert.False(t, ok)
+
+	registry.Unregister("mem", "images")
+	_, ok = registry.Lookup("mem", "images")
+	assert.False(t, ok)
+	assert.Equal(t, string(uri), registry.URL(uri))
+}
+
+func TestRegistry_URL(t *testing.T) {
+	registry := NewRegistry()
+
+	local, err := NewLocal(t.TempDir(), LocalBucket("files"), LocalRegistry(registry), LocalWebPrefix("http://static.example.com/files/"))
+	assert.NoError(t, err)
+	mem, err := NewMemory("images", MemoryRegistry(registry), MemoryWebPrefix("http://cdn.example.com"))
+	assert.NoError(t, err)
+
+	// 与存储的 WebURL 一致
+	for _, store := range []Storage{local, mem} {
+		uri := store.BucketURI("a/b.png")
+		web, err := store.WebURL("a/b.png")
+		assert.NoError(t, err)
+		assert.Equal(t, web, registry.URL(uri))
+		assert.Equal(t, uri, registry.ParseURL(web))
+	}
+}
+
+func TestRegistry_Concurrent(t *testing.T) {
+	registry := NewRegistry()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			bucket := "bucket" + strconv.Itoa(i%4)
+			store, err := NewMemory(bucket, MemoryRegistry(registry))
+			assert.NoError(t, err)
+
+			registry.Lookup("mem", bucket)
+			registry.List()
+			registry.URL(store.BucketURI("a.png"))
+			if i%2 == 0 {
+				registry.Unregister("mem", bucket)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	assert.LessOrEqual(t, len(registry.List()), 4)
+}
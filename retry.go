@@ -0,0 +1,441 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// retryMaxAttempts 默认最多尝试的次数, 包括第一次
+	retryMaxAttempts = 3
+	// retryBaseDelay、retryMaxDelay 退避时间的初始值与上限
+	retryBaseDelay = 100 * time.Millisecond
+	retryMaxDelay  = 5 * time.Second
+	// retryBufferSize 不能 Seek 的上传内容最多缓存的字节数, 超过后不再重试
+	retryBufferSize = 8 << 20
+)
+
+type RetryOptionFunc func(*RetryStorage) error
+
+// RetryMaxAttempts 最多尝试的次数, 包括第一次, 1 表示不重试
+func RetryMaxAttempts(n int) RetryOptionFunc {
+	return func(store *RetryStorage) error {
+		if n < 1 {
+			return newError("retry", "", ErrInvalid, errors.New("max attempts must be at least 1"))
+		}
+		store.maxAttempts = n
+		return nil
+	}
+}
+
+// RetryBackoff 退避时间的初始值与上限, 第 n 次重试前随机等待 [0, min(max, base*2^n))
+func RetryBackoff(base, max time.Duration) RetryOptionFunc {
+	return func(store *RetryStorage) error {
+		if base <= 0 || max < base {
+			return newError("retry", "", ErrInvalid, errors.New("invalid backoff"))
+		}
+		store.baseDelay, store.maxDelay = base, max
+		return nil
+	}
+}
+
+// RetryClassifier 判断错误是否可以重试, 默认为 Retryable
+func RetryClassifier(retryable func(error) bool) RetryOptionFunc {
+	return func(store *RetryStorage) error {
+		store.retryable = retryable
+		return nil
+	}
+}
+
+// RetryBufferSize 不能 Seek 的上传内容最多缓存的字节数, 0 表示不缓存, 此时只有
+// io.ReadSeeker 的上传可以重试
+func RetryBufferSize(n int) RetryOptionFunc {
+	return func(store *RetryStorage) error {
+		if n < 0 {
+			return newError("retry", "", ErrInvalid, errors.New("negative buffer size"))
+		}
+		store.bufferSize = n
+		return nil
+	}
+}
+
+// Retryable 默认的重试判断: 限流、服务端错误、超时与连接中断可以重试,
+// ctx 取消与其它错误不重试; ctx 结束后 RetryStorage 也不再重试
+func Retryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	if errors.Is(err, ErrThrottled) || errors.Is(err, ErrUnavailable) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// RetryStorage 失败后自动重试的存储
+//
+// 只重试幂等的操作: List、Get、Open、Stat、Exist、Put、Copy 与 Remove, 以及分页列举、
+// 范围读取与分片上传; Move 由复制与删除组成, 中途失败后重试结果不确定, 不重试.
+// Open 只重试打开, 读取过程中的错误不重试; ListObjects 按页重试.
+// 上传的内容为 io.ReadSeeker 时重试前回到开始的位置, 否则缓存已读取的内容, 超过
+// RetryBufferSize 后不再重试
+type RetryStorage struct {
+	Storage
+
+	sc          StorageContext
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+	bufferSize  int
+	retryable   func(error) bool
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// NewRetry 包装 store, 默认最多尝试 3 次, 退避时间从 100ms 开始
+func NewRetry(store Storage, opts ...RetryOptionFunc) (*RetryStorage, error) {
+	if store == nil {
+		return nil, newError("retry", "", ErrInvalid, errors.New("nil storage"))
+	}
+
+	var retry = &RetryStorage{
+		Storage:     store,
+		sc:          AdaptContext(store),
+		maxAttempts: retryMaxAttempts,
+		baseDelay:   retryBaseDelay,
+		maxDelay:    retryMaxDelay,
+		bufferSize:  retryBufferSize,
+		retryable:   Retryable,
+		rand:        rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+
+	for _, opt := range opts {
+		if err := opt(retry); err != nil {
+			return nil, err
+		}
+	}
+	return retry, nil
+}
+
+// backoff 第 attempt 次重试前的等待时间, 使用 full jitter
+func (store *RetryStorage) backoff(attempt int) time.Duration {
+	var delay = store.maxDelay
+	if attempt < 32 && store.baseDelay<<uint(attempt) < store.maxDelay {
+		delay = store.baseDelay << uint(attempt)
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return time.Duration(store.rand.Int63n(int64(delay) + 1))
+}
+
+// do 执行 op 直到成功、错误不可重试或者用完尝试次数; rewind 不为空时在重试前调用,
+// 返回 false 表示不能重试
+func (store *RetryStorage) do(ctx context.Context, op func(attempt int) error, rewind func() bool) error {
+	for attempt := 0; ; attempt++ {
+		err := op(attempt)
+		if err == nil || attempt+1 >= store.maxAttempts || !store.retryable(err) || ctx.Err() != nil {
+			return err
+		}
+
+		timer := time.NewTimer(store.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+
+		if rewind != nil && !rewind() {
+			return err
+		}
+	}
+}
+
+func (store *RetryStorage) List(prefix string) ([]os.FileInfo, error) {
+	return store.ListContext(context.Background(), prefix)
+}
+
+func (store *RetryStorage) ListContext(ctx context.Context, prefix string) (objects []os.FileInfo, err error) {
+	err = store.do(ctx, func(int) error {
+		objects, err = store.sc.ListContext(ctx, prefix)
+		return err
+	}, nil)
+	return objects, err
+}
+
+// ListObjects 重试每一页的请求, 已经返回的对象不会重复
+func (store *RetryStorage) ListObjects(ctx context.Context, opts ListOptions) *ObjectIterator {
+	var (
+		it    = Iterate(ctx, store.Storage, opts)
+		fetch = it.fetch
+	)
+	it.fetch = func(ctx context.Context, token string) (page []os.FileInfo, next string, err error) {
+		err = store.do(ctx, func(int) error {
+			page, next, err = fetch(ctx, token)
+			return err
+		}, nil)
+		return page, next, err
+	}
+	return it
+}
+
+func (store *RetryStorage) Get(key string) ([]byte, error) {
+	return store.GetContext(context.Background(), key)
+}
+
+func (store *RetryStorage) GetContext(ctx context.Context, key string) (b []byte, err error) {
+	err = store.do(ctx, func(int) error {
+		b, err = store.sc.GetContext(ctx, key)
+		return err
+	}, nil)
+	return b, err
+}
+
+func (store *RetryStorage) Open(key string) (io.ReadCloser, error) {
+	return store.OpenContext(context.Background(), key)
+}
+
+func (store *RetryStorage) OpenContext(ctx context.Context, key string) (r io.ReadCloser, err error) {
+	err = store.do(ctx, func(int) error {
+		r, err = store.sc.OpenContext(ctx, key)
+		return err
+	}, nil)
+	return r, err
+}
+
+func (store *RetryStorage) GetRange(key string, offset, length int64) (b []byte, err error) {
+	var ctx = context.Background()
+	err = store.do(ctx, func(int) error {
+		b, err = GetRange(ctx, store.Storage, key, offset, length)
+		return err
+	}, nil)
+	return b, err
+}
+
+// OpenRange 与 Open 相同只重试打开
+func (store *RetryStorage) OpenRange(ctx context.Context, key string, offset, length int64) (r io.ReadCloser, err error) {
+	err = store.do(ctx, func(int) error {
+		r, err = OpenRange(ctx, store.Storage, key, offset, length)
+		return err
+	}, nil)
+	return r, err
+}
+
+func (store *RetryStorage) Stat(key string) (os.FileInfo, error) {
+	return store.StatContext(context.Background(), key)
+}
+
+func (store *RetryStorage) StatContext(ctx context.Context, key string) (info os.FileInfo, err error) {
+	err = store.do(ctx, func(int) error {
+		info, err = store.sc.StatContext(ctx, key)
+		return err
+	}, nil)
+	return info, err
+}
+
+func (store *RetryStorage) Exist(key string) bool {
+	return store.ExistContext(context.Background(), key)
+}
+
+// ExistContext 使用重试的 StatContext, 重试后仍然失败时返回 false
+func (store *RetryStorage) ExistContext(ctx context.Context, key string) bool {
+	_, err := store.StatContext(ctx, key)
+	return err == nil
+}
+
+func (store *RetryStorage) PutFile(key string, file string) error {
+	return store.PutFileContext(context.Background(), key, file)
+}
+
+// PutFileContext 每次重试重新打开文件
+func (store *RetryStorage) PutFileContext(ctx context.Context, key string, file string) error {
+	return store.do(ctx, func(int) error {
+		return store.sc.PutFileContext(ctx, key, file)
+	}, nil)
+}
+
+func (store *RetryStorage) Put(key string, val []byte) error {
+	return store.PutContext(context.Background(), key, val)
+}
+
+func (store *RetryStorage) PutContext(ctx context.Context, key string, val []byte) error {
+	return store.do(ctx, func(int) error {
+		return store.sc.PutContext(ctx, key, val)
+	}, nil)
+}
+
+func (store *RetryStorage) PutReader(key string, r io.Reader, size int64) error {
+	return store.PutReaderContext(context.Background(), key, r, size)
+}
+
+func (store *RetryStorage) PutReaderContext(ctx context.Context, key string, r io.Reader, size int64) error {
+	body, err := newReplayBody(r, store.bufferSize)
+	if err != nil {
+		return newError("put", key, nil, err)
+	}
+
+	return store.do(ctx, func(int) error {
+		return store.sc.PutReaderContext(ctx, key, body.reader(), size)
+	}, body.rewind)
+}
+
+func (store *RetryStorage) PutObject(key string, r io.Reader, size int64, opts PutOptions) error {
+	return store.PutObjectContext(context.Background(), key, r, size, opts)
+}
+
+func (store *RetryStorage) PutObjectContext(ctx context.Context, key string, r io.Reader, size int64, opts PutOptions) error {
+	body, err := newReplayBody(r, store.bufferSize)
+	if err != nil {
+		return newError("put", key, nil, err)
+	}
+
+	return store.do(ctx, func(int) error {
+		return PutObject(ctx, store.Storage, key, body.reader(), size, opts)
+	}, body.rewind)
+}
+
+// Move 不是幂等的操作, 不重试
+func (store *RetryStorage) Move(dest string, from string) error {
+	return store.MoveContext(context.Background(), dest, from)
+}
+
+func (store *RetryStorage) MoveContext(ctx context.Context, dest string, from string) error {
+	return store.sc.MoveContext(ctx, dest, from)
+}
+
+func (store *RetryStorage) Remove(key string) error {
+	return store.RemoveContext(context.Background(), key)
+}
+
+// RemoveContext 重试时对象已经不存在, 说明之前的请求已经删除成功
+func (store *RetryStorage) RemoveContext(ctx context.Context, key string) error {
+	return store.do(ctx, func(attempt int) error {
+		err := store.sc.RemoveContext(ctx, key)
+		if attempt > 0 && errors.Is(err, ErrNotExist) {
+			return nil
+		}
+		return err
+	}, nil)
+}
+
+func (store *RetryStorage) Copy(dest string, from string, opts ...CopyOptionFunc) error {
+	return store.CopyContext(context.Background(), dest, from, opts...)
+}
+
+func (store *RetryStorage) CopyContext(ctx context.Context, dest string, from string, opts ...CopyOptionFunc) error {
+	return store.do(ctx, func(int) error {
+		return Copy(ctx, store.Storage, dest, store.Storage, from, opts...)
+	}, nil)
+}
+
+// PutMultipart 失败后重新上传, 设置了 StateFile 时跳过已上传的分片; 底层存储
+// 不支持分片上传时使用 PutReaderContext
+func (store *RetryStorage) PutMultipart(ctx context.Context, key string, r io.ReaderAt, size int64, opts MultipartOptions) error {
+	uploader, ok := store.Storage.(MultipartUploader)
+	if !ok {
+		return store.PutReaderContext(ctx, key, io.NewSectionReader(r, 0, size), size)
+	}
+
+	return store.do(ctx, func(int) error {
+		return uploader.PutMultipart(ctx, key, r, size, opts)
+	}, nil)
+}
+
+// AbortStaleUploads 底层存储不支持分片上传时没有未完成的上传
+func (store *RetryStorage) AbortStaleUploads(ctx context.Context, prefix string, olderThan time.Duration) (n int, err error) {
+	uploader, ok := store.Storage.(MultipartUploader)
+	if !ok {
+		return 0, nil
+	}
+
+	err = store.do(ctx, func(int) error {
+		n, err = uploader.AbortStaleUploads(ctx, prefix, olderThan)
+		return err
+	}, nil)
+	return n, err
+}
+
+// replayBody 可以重新读取的上传内容
+//
+// io.ReadSeeker 记录开始的位置, 重试前 Seek 回去; 其它 Reader 边读边缓存,
+// 重试时先读缓存再继续读取, 缓存超过 limit 后不能重试
+type replayBody struct {
+	r      io.Reader
+	seeker io.Seeker
+	start  int64
+	limit  int
+	buf    []byte
+	over   bool
+}
+
+func newReplayBody(r io.Reader, limit int) (*replayBody, error) {
+	var body = &replayBody{r: r, limit: limit}
+	if seeker, ok := r.(io.ReadSeeker); ok {
+		start, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+		body.seeker, body.start = seeker, start
+	}
+	return body, nil
+}
+
+// reader 本次尝试使用的 Reader, 可以 Seek 时原样返回, 便于后端使用 Content-Length 上传
+func (body *replayBody) reader() io.Reader {
+	if body.seeker != nil {
+		return body.r
+	}
+	return io.MultiReader(bytes.NewReader(body.buf), (*replayRecorder)(body))
+}
+
+// rewind 回到开始的位置, 返回是否可以重试
+func (body *replayBody) rewind() bool {
+	if body.seeker != nil {
+		_, err := body.seeker.Seek(body.start, io.SeekStart)
+		return err == nil
+	}
+	return !body.over
+}
+
+// replayRecorder 从原始的 Reader 读取并记录到缓存
+type replayRecorder replayBody
+
+func (rec *replayRecorder) Read(p []byte) (int, error) {
+	n, err := rec.r.Read(p)
+	if !rec.over {
+		if len(rec.buf)+n > rec.limit {
+			rec.over, rec.buf = true, nil
+		} else {
+			rec.buf = append(rec.buf, p[:n]...)
+		}
+	}
+	return n, err
+}
+
+var (
+	_ StorageContext    = &RetryStorage{}
+	_ Putter            = &RetryStorage{}
+	_ Copier            = &RetryStorage{}
+	_ Lister            = &RetryStorage{}
+	_ RangeReader       = &RetryStorage{}
+	_ MultipartUploader = &RetryStorage{}
+)
@@ -0,0 +1,242 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// flakyStorage 前 failures 次调用返回 err, 上传失败前先读取 partial 字节
+type flakyStorage struct {
+	Storage
+
+	failures int
+	partial  int
+	err      error
+	calls    int
+}
+
+func (store *flakyStorage) fail() error {
+	store.calls++
+	if store.calls <= store.failures {
+		return store.err
+	}
+	return nil
+}
+
+func (store *flakyStorage) Get(key string) ([]byte, error) {
+	if err := store.fail(); err != nil {
+		return nil, err
+	}
+	return store.Storage.Get(key)
+}
+
+func (store *flakyStorage) Open(key string) (io.ReadCloser, error) {
+	if err := store.fail(); err != nil {
+		return nil, err
+	}
+	return store.Storage.Open(key)
+}
+
+func (store *flakyStorage) List(prefix string) ([]os.FileInfo, error) {
+	if err := store.fail(); err != nil {
+		return nil, err
+	}
+	return store.Storage.List(prefix)
+}
+
+func (store *flakyStorage) Stat(key string) (os.FileInfo, error) {
+	if err := store.fail(); err != nil {
+		return nil, err
+	}
+	return store.Storage.Stat(key)
+}
+
+func (store *flakyStorage) Put(key string, val []byte) error {
+	if err := store.fail(); err != nil {
+		return err
+	}
+	return store.Storage.Put(key, val)
+}
+
+func (store *flakyStorage) PutReader(key string, r io.Reader, size int64) error {
+	if err := store.fail(); err != nil {
+		io.CopyN(io.Discard, r, int64(store.partial))
+		return err
+	}
+	return store.Storage.PutReader(key, r, size)
+}
+
+func (store *flakyStorage) Move(dest string, from string) error {
+	if err := store.fail(); err != nil {
+		return err
+	}
+	return store.Storage.Move(dest, from)
+}
+
+// Remove 删除成功后仍然返回 err, 对象不存在时返回 ErrNotExist
+func (store *flakyStorage) Remove(key string) error {
+	if !store.Storage.Exist(key) {
+		store.calls++
+		return newError("remove", key, ErrNotExist, nil)
+	}
+
+	store.Storage.Remove(key)
+	return store.fail()
+}
+
+func newFlaky(t *testing.T, failures int, err error, opts ...RetryOptionFunc) (*RetryStorage, *flakyStorage) {
+	inner, merr := NewMemory("retry", MemoryRegistry(NewRegistry()))
+	assert.NoError(t, merr)
+
+	flaky := &flakyStorage{Storage: inner, failures: failures, err: err}
+	store, rerr := NewRetry(flaky, append([]RetryOptionFunc{RetryBackoff(time.Millisecond, time.Millisecond)}, opts...)...)
+	assert.NoError(t, rerr)
+	return store, flaky
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{newError("get", "a", ErrThrottled, nil), true},
+		{statusError("get", "a", &http.Response{StatusCode: http.StatusServiceUnavailable, Status: "503 Service Unavailable"}), true},
+		{&net.OpError{Op: "read", Err: syscall.ECONNRESET}, true},
+		{fmt.Errorf("upload: %w", io.ErrUnexpectedEOF), true},
+		{newError("get", "a", ErrNotExist, nil), false},
+		{newError("get", "a", ErrPermission, nil), false},
+		{context.Canceled, false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Retryable(tt.err), fmt.Sprint(tt.err))
+	}
+}
+
+func TestRetryStorage_Get(t *testing.T) {
+	store, flaky := newFlaky(t, 2, newError("get", "a", ErrUnavailable, nil))
+	assert.NoError(t, flaky.Storage.Put("a", []byte("hello")))
+
+	got, err := store.Get("a")
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(got))
+	assert.Equal(t, 3, flaky.calls)
+
+	// 用完尝试次数
+	store, flaky = newFlaky(t, 5, newError("get", "a", ErrThrottled, nil), RetryMaxAttempts(2))
+	_, err = store.Get("a")
+	assert.True(t, errors.Is(err, ErrThrottled))
+	assert.Equal(t, 2, flaky.calls)
+
+	// 不可重试的错误
+	store, flaky = newFlaky(t, 5, newError("get", "a", ErrPermission, nil))
+	_, err = store.Get("a")
+	assert.True(t, errors.Is(err, ErrPermission))
+	assert.Equal(t, 1, flaky.calls)
+
+	// ctx 结束后不再重试
+	store, flaky = newFlaky(t, 5, newError("get", "a", ErrUnavailable, nil), RetryBackoff(time.Hour, time.Hour))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = store.GetContext(ctx, "a")
+	assert.True(t, errors.Is(err, ErrUnavailable))
+	assert.Equal(t, 1, flaky.calls)
+}
+
+func TestRetryStorage_PutReader(t *testing.T) {
+	var content = strings.Repeat("0123456789", 100)
+
+	// 不能 Seek 的内容缓存后重放
+	store, flaky := newFlaky(t, 2, newError("put", "a", ErrUnavailable, nil))
+	flaky.partial = 300
+	assert.NoError(t, store.PutReader("a", onlyReader{strings.NewReader(content)}, int64(len(content))))
+	got, err := flaky.Storage.Get("a")
+	assert.NoError(t, err)
+	assert.Equal(t, content, string(got))
+	assert.Equal(t, 3, flaky.calls)
+
+	// 可以 Seek 的内容回到开始的位置
+	store, flaky = newFlaky(t, 1, newError("put", "a", ErrUnavailable, nil))
+	flaky.partial = 300
+	r := strings.NewReader("header" + content)
+	r.Seek(6, io.SeekStart)
+	assert.NoError(t, store.PutReader("a", r, int64(len(content))))
+	got, err = flaky.Storage.Get("a")
+	assert.NoError(t, err)
+	assert.Equal(t, content, string(got))
+
+	// 超过缓存大小后不能重试
+	store, flaky = newFlaky(t, 1, newError("put", "a", ErrUnavailable, nil), RetryBufferSize(100))
+	flaky.partial = 300
+	err = store.PutObject("a", onlyReader{strings.NewReader(content)}, int64(len(content)), PutOptions{})
+	assert.True(t, errors.Is(err, ErrUnavailable))
+	assert.Equal(t, 1, flaky.calls)
+
+	// Put 的内容可以直接重放
+	store, flaky = newFlaky(t, 1, newError("put", "a", ErrUnavailable, nil))
+	assert.NoError(t, store.Put("a", bytes.Repeat([]byte("x"), 10)))
+	assert.Equal(t, 2, flaky.calls)
+}
+
+func TestRetryStorage_Move(t *testing.T) {
+	// Move 不是幂等的操作, 不重试
+	store, flaky := newFlaky(t, 1, newError("move", "a", ErrUnavailable, nil))
+	assert.NoError(t, flaky.Storage.Put("a", []byte("hello")))
+	err := store.Move("b", "a")
+	assert.True(t, errors.Is(err, ErrUnavailable))
+	assert.Equal(t, 1, flaky.calls)
+
+	// 第一次删除已经成功但返回了错误, 重试时对象不存在视为成功
+	store, flaky = newFlaky(t, 1, newError("remove", "a", ErrUnavailable, nil))
+	assert.NoError(t, flaky.Storage.Put("a", []byte("hello")))
+	assert.NoError(t, store.Remove("a"))
+	assert.Equal(t, 2, flaky.calls)
+	assert.False(t, flaky.Storage.Exist("a"))
+}
+
+func TestRetryStorage_forward(t *testing.T) {
+	// Exist 使用重试的 Stat
+	store, flaky := newFlaky(t, 2, newError("stat", "a", ErrUnavailable, nil))
+	assert.NoError(t, flaky.Storage.Put("a", []byte("hello")))
+	assert.True(t, store.Exist("a"))
+	assert.Equal(t, 3, flaky.calls)
+
+	store, flaky = newFlaky(t, 2, newError("list", "", ErrUnavailable, nil))
+	assert.NoError(t, flaky.Storage.Put("a", []byte("hello")))
+	it := Iterate(context.Background(), store, ListOptions{Recursive: true})
+	assert.True(t, it.Next())
+	assert.Equal(t, "a", it.Object().Name())
+	assert.False(t, it.Next())
+	assert.NoError(t, it.Err())
+	assert.Equal(t, 3, flaky.calls)
+
+	store, flaky = newFlaky(t, 2, newError("open", "a", ErrUnavailable, nil))
+	assert.NoError(t, flaky.Storage.Put("a", []byte("hello")))
+	got, err := GetRange(context.Background(), store, "a", 1, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, "ell", string(got))
+	assert.Equal(t, 3, flaky.calls)
+
+	// 底层存储不支持分片上传时使用 PutReader
+	store, flaky = newFlaky(t, 1, newError("put", "a", ErrUnavailable, nil))
+	flaky.partial = 3
+	var content = strings.NewReader("hello world")
+	assert.NoError(t, store.PutMultipart(context.Background(), "a", content, content.Size(), MultipartOptions{}))
+	got, err = flaky.Storage.Get("a")
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world", string(got))
+	assert.Equal(t, 2, flaky.calls)
+}
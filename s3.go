@@ -2,16 +2,23 @@ package storage
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net/http"
 	"net/url"
 	"os"
 	"path"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 )
 
 // S3ObjectStorage S3 简单存储对象
@@ -22,8 +29,10 @@ type S3ObjectStorage struct {
 	Region     string
 	Bucket     string
 	HttpPrefix string
+	Encryption *Encryption
 
-	svc *s3.S3
+	svc      *s3.S3
+	registry *Registry
 }
 
 func S3WebPrefix(url string) S3OptionFunc {
@@ -42,10 +51,12 @@ func NewS3(appkey, secret string, bucket string, sess *session.Session, opts ...
 	}
 
 	for _, opt := range opts {
-		opt(store)
+		if err = opt(store); err != nil {
+			return nil, err
+		}
 	}
 
-	register("s3", store, store.Hostname())
+	register(store.registry, "s3", store, store.Hostname())
 
 	return store, nil
 }
@@ -72,142 +83,716 @@ func (store *S3ObjectStorage) Hostname() string {
 
 // List 列出 S3 Object 清单
 func (store *S3ObjectStorage) List(prefix string) (objects []os.FileInfo, err error) {
-	input := &s3.ListObjectsInput{
-		Bucket: &store.Bucket,
-		// Delimiter: aws.String("/"),
-		Prefix:  aws.String(prefix),
-		MaxKeys: aws.Int64(100),
-	}
+	return store.ListContext(context.Background(), prefix)
+}
 
-	result, err := store.svc.ListObjects(input)
-	if err != nil {
-		if aerr, ok := err.(awserr.Error); ok {
-			switch aerr.Code() {
-			default:
-				return nil, err
-			}
-		} else {
-			// Print the error, cast err to awserr.Error to get the Code and
-			// Message from an error.
-			return nil, err
-		}
+func (store *S3ObjectStorage) ListContext(ctx context.Context, prefix string) (objects []os.FileInfo, err error) {
+	objects = make([]os.FileInfo, 0)
+
+	it := store.ListObjects(ctx, ListOptions{Prefix: prefix, Recursive: true})
+	for it.Next() {
+		objects = append(objects, it.Object())
+	}
+	if err = it.Err(); err != nil {
+		return nil, err
 	}
+	return
+}
 
-	objects = make([]os.FileInfo, 0, len(result.Contents))
-	for _, cont := range result.Contents {
+// ListObjects 使用 ListObjectsV2 与 continuation token 按页惰性列举对象
+func (store *S3ObjectStorage) ListObjects(ctx context.Context, opts ListOptions) *ObjectIterator {
+	return newObjectIterator(ctx, opts, func(ctx context.Context, token string) ([]os.FileInfo, string, error) {
+		input := &s3.ListObjectsV2Input{
+			Bucket:  aws.String(store.Bucket),
+			Prefix:  aws.String(opts.Prefix),
+			MaxKeys: aws.Int64(int64(opts.pageSize())),
+		}
+		if delimiter := opts.delimiter(); delimiter != "" {
+			input.Delimiter = aws.String(delimiter)
+		}
+		if opts.StartAfter != "" {
+			input.StartAfter = aws.String(opts.StartAfter)
+		}
+		if token != "" {
+			input.ContinuationToken = aws.String(token)
+		}
 
-		var obj = &ObjectInfo{key: *cont.Key, size: *cont.Size, time: *cont.LastModified}
-		if obj.key[len(obj.key)-1] == '/' {
-			obj.isDir = true
+		result, err := store.svc.ListObjectsV2WithContext(ctx, input)
+		if err != nil {
+			return nil, "", s3Error("list", opts.Prefix, err)
 		}
 
-		objects = append(objects, obj)
-	}
-	return
+		var (
+			objects  = make([]os.FileInfo, 0, len(result.Contents)+len(result.CommonPrefixes))
+			prefixes = make([]string, 0, len(result.CommonPrefixes))
+			next     string
+		)
+		for _, cont := range result.Contents {
+			var key = aws.StringValue(cont.Key)
+			objects = append(objects, &ObjectInfo{
+				key:   key,
+				size:  aws.Int64Value(cont.Size),
+				time:  aws.TimeValue(cont.LastModified),
+				isDir: strings.HasSuffix(key, "/"),
+				meta: &ObjectMeta{
+					ETag:         strings.Trim(aws.StringValue(cont.ETag), `"`),
+					StorageClass: aws.StringValue(cont.StorageClass),
+				},
+			})
+		}
+		for _, prefix := range result.CommonPrefixes {
+			prefixes = append(prefixes, aws.StringValue(prefix.Prefix))
+		}
+		if aws.BoolValue(result.IsTruncated) {
+			next = aws.StringValue(result.NextContinuationToken)
+		}
+		return mergePage(objects, prefixes), next, nil
+	})
 }
 
 // Get 获取 S3 Object 对象
 func (store *S3ObjectStorage) Get(key string) ([]byte, error) {
-	input := &s3.GetObjectInput{
-		Bucket: aws.String(store.Bucket),
-		Key:    aws.String(key),
-		// Range:  aws.String("bytes=0-9"),
+	return store.GetContext(context.Background(), key)
+}
+
+func (store *S3ObjectStorage) GetContext(ctx context.Context, key string) ([]byte, error) {
+	body, err := store.OpenContext(ctx, key)
+	if err != nil {
+		return nil, err
 	}
+	defer body.Close()
 
-	result, err := store.svc.GetObject(input)
+	b, err := ioutil.ReadAll(body)
 	if err != nil {
+		return nil, s3Error("get", key, err)
+	}
+	return b, nil
+}
+
+func (store *S3ObjectStorage) Open(key string) (io.ReadCloser, error) {
+	return store.OpenContext(context.Background(), key)
+}
+
+// OpenContext 打开 S3 Object 的读取流, 调用者需要负责关闭
+func (store *S3ObjectStorage) OpenContext(ctx context.Context, key string) (io.ReadCloser, error) {
+	return store.OpenRange(ctx, key, 0, -1)
+}
+
+func (store *S3ObjectStorage) GetRange(key string, offset, length int64) ([]byte, error) {
+	return getRange(store, key, offset, length)
+}
+
+// OpenRange 通过 Range 参数读取对象的部分内容
+func (store *S3ObjectStorage) OpenRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	if err := checkRange(key, offset); err != nil {
+		return nil, err
+	}
+	if length == 0 {
+		return emptyBody(), nil
+	}
 
+	sse, err := store.sse(ctx, "open", key, nil)
+	if err != nil {
 		return nil, err
 	}
 
-	return ioutil.ReadAll(result.Body)
+	input := &s3.GetObjectInput{
+		Bucket:               aws.String(store.Bucket),
+		Key:                  aws.String(key),
+		Range:                s3String(rangeHeader(offset, length)),
+		SSECustomerAlgorithm: sse.customerAlgorithm,
+		SSECustomerKey:       sse.customerKey,
+	}
+
+	result, err := store.svc.GetObjectWithContext(ctx, input)
+	if err != nil {
+		return nil, s3Error("open", key, err)
+	}
+
+	return result.Body, nil
 }
 
 func (store *S3ObjectStorage) Put(key string, val []byte) error {
-	input := &s3.PutObjectInput{
-		Body:   aws.ReadSeekCloser(bytes.NewBuffer(val)),
-		Bucket: aws.String(store.Bucket),
-		Key:    aws.String(key),
-		// ServerSideEncryption: aws.String("AES256"),
-		// StorageClass:         aws.String("STANDARD_IA"),
-	}
+	return store.PutContext(context.Background(), key, val)
+}
+
+func (store *S3ObjectStorage) PutContext(ctx context.Context, key string, val []byte) error {
+	return store.PutReaderContext(ctx, key, bytes.NewReader(val), int64(len(val)))
+}
 
-	_, err := store.svc.PutObject(input)
+func (store *S3ObjectStorage) PutReader(key string, r io.Reader, size int64) error {
+	return store.PutReaderContext(context.Background(), key, r, size)
+}
+
+func (store *S3ObjectStorage) PutReaderContext(ctx context.Context, key string, r io.Reader, size int64) error {
+	return store.PutObjectContext(ctx, key, r, size, PutOptions{})
+}
+
+func (store *S3ObjectStorage) PutObject(key string, r io.Reader, size int64, opts PutOptions) error {
+	return store.PutObjectContext(context.Background(), key, r, size, opts)
+}
+
+// PutObjectContext 以流的方式上传并设置元数据, 长度已知且可 Seek 的数据直接 PutObject,
+// 其它数据交给 s3manager 分片上传, 不会整体读入内存
+func (store *S3ObjectStorage) PutObjectContext(ctx context.Context, key string, r io.Reader, size int64, opts PutOptions) error {
+	sse, err := store.sse(ctx, "put", key, opts.Encryption)
 	if err != nil {
+		return err
+	}
 
+	r, err = opts.detect(key, r)
+	if err != nil {
 		return err
 	}
 
-	return nil
+	if rs, ok := r.(io.ReadSeeker); ok && size >= 0 {
+		input := &s3.PutObjectInput{
+			Body:                 aws.ReadSeekCloser(rs),
+			Bucket:               aws.String(store.Bucket),
+			Key:                  aws.String(key),
+			ContentLength:        aws.Int64(size),
+			ContentType:          s3String(opts.ContentType),
+			ContentDisposition:   s3String(opts.ContentDisposition),
+			CacheControl:         s3String(opts.CacheControl),
+			ContentEncoding:      s3String(opts.ContentEncoding),
+			Metadata:             aws.StringMap(opts.Metadata),
+			StorageClass:         s3String(opts.StorageClass),
+			ServerSideEncryption: sse.serverSide,
+			SSEKMSKeyId:          sse.kmsKeyID,
+			SSECustomerAlgorithm: sse.customerAlgorithm,
+			SSECustomerKey:       sse.customerKey,
+		}
+
+		_, err = store.svc.PutObjectWithContext(ctx, input)
+		return s3Error("put", key, err)
+	}
+
+	uploader := s3manager.NewUploaderWithClient(store.svc)
+	_, err = uploader.UploadWithContext(ctx, &s3manager.UploadInput{
+		Body:                 r,
+		Bucket:               aws.String(store.Bucket),
+		Key:                  aws.String(key),
+		ContentType:          s3String(opts.ContentType),
+		ContentDisposition:   s3String(opts.ContentDisposition),
+		CacheControl:         s3String(opts.CacheControl),
+		ContentEncoding:      s3String(opts.ContentEncoding),
+		Metadata:             aws.StringMap(opts.Metadata),
+		StorageClass:         s3String(opts.StorageClass),
+		ServerSideEncryption: sse.serverSide,
+		SSEKMSKeyId:          sse.kmsKeyID,
+		SSECustomerAlgorithm: sse.customerAlgorithm,
+		SSECustomerKey:       sse.customerKey,
+	})
+	return s3Error("put", key, err)
 }
 
 func (store *S3ObjectStorage) PutFile(key string, file string) error {
-	f, err := os.OpenFile(file, os.O_RDONLY, os.ModePerm)
-	if err != nil {
+	return store.PutFileContext(context.Background(), key, file)
+}
+
+func (store *S3ObjectStorage) PutFileContext(ctx context.Context, key string, file string) error {
+	return putFile(ctx, store, key, file)
+}
+
+func (store *S3ObjectStorage) Move(dest string, from string) error {
+	return store.MoveContext(context.Background(), dest, from)
+}
+
+// MoveContext 复制后删除源对象
+func (store *S3ObjectStorage) MoveContext(ctx context.Context, dest string, from string) error {
+	if err := store.CopyContext(ctx, dest, from); err != nil {
 		return err
 	}
-	defer f.Close()
+	return store.RemoveContext(ctx, from)
+}
 
-	input := &s3.PutObjectInput{
-		Body:   aws.ReadSeekCloser(f),
-		Bucket: aws.String(store.Bucket),
-		Key:    aws.String(key),
-		// ServerSideEncryption: aws.String("AES256"),
-		// StorageClass:         aws.String("STANDARD_IA"),
-	}
+const (
+	// s3MaxCopySize CopyObject 支持的最大对象, 更大的对象需要分片复制
+	s3MaxCopySize = 5 << 30
+	// s3CopyPartSize 分片复制时每片的大小
+	s3CopyPartSize = 512 << 20
+)
 
-	_, err = store.svc.PutObject(input)
+func (store *S3ObjectStorage) Copy(dest string, from string, opts ...CopyOptionFunc) error {
+	return store.CopyContext(context.Background(), dest, from, opts...)
+}
+
+// CopyContext 服务端复制, 大于 5GiB 的对象使用 UploadPartCopy 分片复制
+func (store *S3ObjectStorage) CopyContext(ctx context.Context, dest string, from string, opts ...CopyOptionFunc) error {
+	var copts = newCopyOptions(store.Bucket, opts)
+
+	dstSSE, err := store.sse(ctx, "copy", dest, nil)
+	if err != nil {
+		return err
+	}
+	// 源对象使用 SSE-C 时需要提供源对象的密钥, 默认与目标对象相同
+	srcSSE, err := store.sse(ctx, "copy", from, copts.SourceEncryption)
 	if err != nil {
 		return err
 	}
 
+	head, err := store.svc.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket:               aws.String(copts.SourceBucket),
+		Key:                  aws.String(from),
+		SSECustomerAlgorithm: srcSSE.customerAlgorithm,
+		SSECustomerKey:       srcSSE.customerKey,
+	})
+	if err != nil {
+		return s3Error("copy", from, err)
+	}
+
+	// 替换元数据时没有指定的 Content-Type 会被重置, 沿用源对象的
+	var contentType = head.ContentType
+	if copts.ContentType != "" {
+		contentType = aws.String(copts.ContentType)
+	}
+
+	if aws.Int64Value(head.ContentLength) > s3MaxCopySize {
+		return store.copyMultipart(ctx, dest, from, copts, head, contentType, dstSSE, srcSSE)
+	}
+
+	input := &s3.CopyObjectInput{
+		Bucket:                         aws.String(store.Bucket),
+		CopySource:                     aws.String(s3CopySource(copts.SourceBucket, from)),
+		Key:                            aws.String(dest),
+		ServerSideEncryption:           dstSSE.serverSide,
+		SSEKMSKeyId:                    dstSSE.kmsKeyID,
+		SSECustomerAlgorithm:           dstSSE.customerAlgorithm,
+		SSECustomerKey:                 dstSSE.customerKey,
+		CopySourceSSECustomerAlgorithm: srcSSE.customerAlgorithm,
+		CopySourceSSECustomerKey:       srcSSE.customerKey,
+	}
+
+	if copts.replace() {
+		input.MetadataDirective = aws.String(s3.MetadataDirectiveReplace)
+		input.Metadata = aws.StringMap(copts.Metadata)
+		input.ContentType = contentType
+	}
+
+	if _, err = store.svc.CopyObjectWithContext(ctx, input); err != nil {
+		return s3Error("copy", from, err)
+	}
 	return nil
 }
 
-func (store *S3ObjectStorage) Move(dest string, from string) error {
+// copyMultipart 使用 UploadPartCopy 分片复制大对象, 出错时取消分片上传
+func (store *S3ObjectStorage) copyMultipart(ctx context.Context, dest, from string, copts CopyOptions, head *s3.HeadObjectOutput, contentType *string, dstSSE, srcSSE *s3SSE) error {
+	var metadata = head.Metadata
+	if copts.replace() {
+		metadata = aws.StringMap(copts.Metadata)
+	}
 
-	input := &s3.CopyObjectInput{
-		Bucket:     aws.String(store.Bucket),
-		CopySource: aws.String(path.Join(store.Bucket, from)),
-		Key:        aws.String(dest),
-		// ServerSideEncryption: aws.String("AES256"),
-		// StorageClass:         aws.String("STANDARD_IA"),
+	input := &s3.CreateMultipartUploadInput{
+		Bucket:               aws.String(store.Bucket),
+		Key:                  aws.String(dest),
+		Metadata:             metadata,
+		ContentType:          contentType,
+		ServerSideEncryption: dstSSE.serverSide,
+		SSEKMSKeyId:          dstSSE.kmsKeyID,
+		SSECustomerAlgorithm: dstSSE.customerAlgorithm,
+		SSECustomerKey:       dstSSE.customerKey,
+	}
+
+	// 与 CopyObject 的 COPY 指令一致, 不替换元数据时沿用源对象的标准头部
+	if !copts.replace() {
+		input.CacheControl = head.CacheControl
+		input.ContentDisposition = head.ContentDisposition
+		input.ContentEncoding = head.ContentEncoding
+		input.ContentLanguage = head.ContentLanguage
 	}
-	_, err := store.svc.CopyObject(input)
+
+	create, err := store.svc.CreateMultipartUploadWithContext(ctx, input)
 	if err != nil {
+		return s3Error("copy", dest, err)
+	}
+
+	var (
+		uploadID = aws.StringValue(create.UploadId)
+		size     = aws.Int64Value(head.ContentLength)
+		parts    []multipartPart
+	)
 
+	for offset, number := int64(0), 1; offset < size; offset, number = offset+s3CopyPartSize, number+1 {
+		end := offset + s3CopyPartSize - 1
+		if end >= size {
+			end = size - 1
+		}
+
+		result, err := store.svc.UploadPartCopyWithContext(ctx, &s3.UploadPartCopyInput{
+			Bucket:                         aws.String(store.Bucket),
+			Key:                            aws.String(dest),
+			UploadId:                       aws.String(uploadID),
+			PartNumber:                     aws.Int64(int64(number)),
+			CopySource:                     aws.String(s3CopySource(copts.SourceBucket, from)),
+			CopySourceRange:                aws.String(fmt.Sprintf("bytes=%d-%d", offset, end)),
+			SSECustomerAlgorithm:           dstSSE.customerAlgorithm,
+			SSECustomerKey:                 dstSSE.customerKey,
+			CopySourceSSECustomerAlgorithm: srcSSE.customerAlgorithm,
+			CopySourceSSECustomerKey:       srcSSE.customerKey,
+		})
+		if err != nil {
+			store.abortUpload(context.Background(), dest, uploadID)
+			return s3Error("copy", from, err)
+		}
+
+		parts = append(parts, multipartPart{Number: number, ETag: aws.StringValue(result.CopyPartResult.ETag)})
+	}
+
+	if err = store.completeUpload(ctx, dest, uploadID, parts); err != nil {
+		store.abortUpload(context.Background(), dest, uploadID)
 		return err
 	}
+	return nil
+}
 
-	return store.Remove(from)
+// s3SSE 服务端加密的请求参数; SSE-C 的密钥由 aws-sdk 编码并计算 MD5
+type s3SSE struct {
+	serverSide        *string
+	kmsKeyID          *string
+	customerAlgorithm *string
+	customerKey       *string
+}
+
+// sse 返回本次调用使用的加密参数; 读取对象时只会用到 SSE-C 的参数
+func (store *S3ObjectStorage) sse(ctx context.Context, op, key string, explicit *Encryption) (*s3SSE, error) {
+	enc, err := encryptionOf(ctx, op, key, explicit, store.Encryption)
+	if err != nil {
+		return nil, err
+	}
+
+	var sse s3SSE
+	if enc == nil {
+		return &sse, nil
+	}
+
+	switch enc.Type {
+	case SSES3:
+		sse.serverSide = aws.String(s3.ServerSideEncryptionAes256)
+	case SSEKMS:
+		sse.serverSide = aws.String(s3.ServerSideEncryptionAwsKms)
+		sse.kmsKeyID = s3String(enc.KeyID)
+	case SSEC:
+		sse.customerAlgorithm = aws.String(s3.ServerSideEncryptionAes256)
+		sse.customerKey = aws.String(string(enc.Key))
+	}
+	return &sse, nil
+}
+
+// s3CopySource 返回 URL 编码后的复制源
+func s3CopySource(bucket, key string) string {
+	u := url.URL{Path: bucket + "/" + key}
+	return u.EscapedPath()
+}
+
+// sameBackend 同一个服务地址与账号下的存储空间之间可以服务端复制
+func (store *S3ObjectStorage) sameBackend(src Storage) bool {
+	other, ok := src.(*S3ObjectStorage)
+	return ok && other.svc.Endpoint == store.svc.Endpoint && other.AccessKey == store.AccessKey
 }
 
 func (store *S3ObjectStorage) Remove(key string) error {
+	return store.RemoveContext(context.Background(), key)
+}
+
+func (store *S3ObjectStorage) RemoveContext(ctx context.Context, key string) error {
 	input := &s3.DeleteObjectInput{
 		Bucket: aws.String(store.Bucket),
 		Key:    aws.String(key),
 	}
 
-	_, err := store.svc.DeleteObject(input)
+	_, err := store.svc.DeleteObjectWithContext(ctx, input)
 	if err != nil {
-
-		return err
+		return s3Error("remove", key, err)
 	}
 	return nil
 }
 
+// RemoveMany 使用 DeleteObjects 批量删除, 每 1000 个 key 发送一次请求
+func (store *S3ObjectStorage) RemoveMany(ctx context.Context, keys []string) ([]BatchResult, error) {
+	var errs = make(map[string]error)
+
+	for _, chunk := range batchChunks(keys) {
+		var objects = make([]*s3.ObjectIdentifier, len(chunk))
+		for i, key := range chunk {
+			objects[i] = &s3.ObjectIdentifier{Key: aws.String(key)}
+		}
+
+		result, err := store.svc.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(store.Bucket),
+			Delete: &s3.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return nil, s3Error("remove", "", err)
+		}
+
+		for _, e := range result.Errors {
+			key := aws.StringValue(e.Key)
+			errs[key] = s3Error("remove", key, awserr.New(aws.StringValue(e.Code), aws.StringValue(e.Message), nil))
+		}
+	}
+	return batchResults(keys, errs), nil
+}
+
+// RemovePrefix 删除 prefix 下的所有对象
+func (store *S3ObjectStorage) RemovePrefix(ctx context.Context, prefix string) ([]BatchResult, error) {
+	return removePrefix(ctx, store, prefix)
+}
+
+// StatMany S3 没有批量获取元数据的接口, 并发调用 HeadObject
+func (store *S3ObjectStorage) StatMany(ctx context.Context, keys []string) ([]BatchResult, error) {
+	return statMany(ctx, store, keys)
+}
+
 func (store *S3ObjectStorage) Exist(key string) bool {
+	return store.ExistContext(context.Background(), key)
+}
+
+func (store *S3ObjectStorage) ExistContext(ctx context.Context, key string) bool {
+	_, err := store.StatContext(ctx, key)
+	return err == nil
+}
+
+// Stat 获取 S3 Object 的元数据
+func (store *S3ObjectStorage) Stat(key string) (os.FileInfo, error) {
+	return store.StatContext(context.Background(), key)
+}
+
+func (store *S3ObjectStorage) StatContext(ctx context.Context, key string) (os.FileInfo, error) {
+	sse, err := store.sse(ctx, "stat", key, nil)
+	if err != nil {
+		return nil, err
+	}
+
 	input := &s3.HeadObjectInput{
+		Bucket:               aws.String(store.Bucket),
+		Key:                  aws.String(key),
+		SSECustomerAlgorithm: sse.customerAlgorithm,
+		SSECustomerKey:       sse.customerKey,
+	}
+
+	result, err := store.svc.HeadObjectWithContext(ctx, input)
+	if err != nil {
+		return nil, s3Error("stat", key, err)
+	}
+
+	var meta = make(map[string]string, len(result.Metadata))
+	for k, v := range result.Metadata {
+		meta[strings.ToLower(k)] = aws.StringValue(v)
+	}
+
+	return &ObjectInfo{
+		key:   key,
+		size:  aws.Int64Value(result.ContentLength),
+		time:  aws.TimeValue(result.LastModified),
+		isDir: strings.HasSuffix(key, "/"),
+		meta: &ObjectMeta{
+			ContentType:        aws.StringValue(result.ContentType),
+			ContentEncoding:    aws.StringValue(result.ContentEncoding),
+			ContentDisposition: aws.StringValue(result.ContentDisposition),
+			CacheControl:       aws.StringValue(result.CacheControl),
+			Expires:            parseHTTPTime(aws.StringValue(result.Expires)),
+			ETag:               strings.Trim(aws.StringValue(result.ETag), `"`),
+			StorageClass:       aws.StringValue(result.StorageClass),
+			VersionID:          aws.StringValue(result.VersionId),
+			Metadata:           meta,
+		},
+	}, nil
+}
+
+// PutMultipart 使用 S3 的分片上传接口上传大文件, 支持断点续传
+func (store *S3ObjectStorage) PutMultipart(ctx context.Context, key string, r io.ReaderAt, size int64, opts MultipartOptions) error {
+	return putMultipart(ctx, store, key, r, size, opts)
+}
+
+func (store *S3ObjectStorage) initiateUpload(ctx context.Context, key string) (string, error) {
+	sse, err := store.sse(ctx, "put", key, nil)
+	if err != nil {
+		return "", err
+	}
+
+	result, err := store.svc.CreateMultipartUploadWithContext(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:               aws.String(store.Bucket),
+		Key:                  aws.String(key),
+		ServerSideEncryption: sse.serverSide,
+		SSEKMSKeyId:          sse.kmsKeyID,
+		SSECustomerAlgorithm: sse.customerAlgorithm,
+		SSECustomerKey:       sse.customerKey,
+	})
+	if err != nil {
+		return "", s3Error("put", key, err)
+	}
+	return aws.StringValue(result.UploadId), nil
+}
+
+func (store *S3ObjectStorage) uploadPart(ctx context.Context, key, uploadID string, number int, r io.ReadSeeker, size int64) (string, error) {
+	sse, err := store.sse(ctx, "put", key, nil)
+	if err != nil {
+		return "", err
+	}
+
+	result, err := store.svc.UploadPartWithContext(ctx, &s3.UploadPartInput{
+		Bucket:               aws.String(store.Bucket),
+		Key:                  aws.String(key),
+		UploadId:             aws.String(uploadID),
+		PartNumber:           aws.Int64(int64(number)),
+		Body:                 r,
+		ContentLength:        aws.Int64(size),
+		SSECustomerAlgorithm: sse.customerAlgorithm,
+		SSECustomerKey:       sse.customerKey,
+	})
+	if err != nil {
+		return "", s3Error("put", key, err)
+	}
+	return aws.StringValue(result.ETag), nil
+}
+
+func (store *S3ObjectStorage) completeUpload(ctx context.Context, key, uploadID string, parts []multipartPart) error {
+	var completed = make([]*s3.CompletedPart, 0, len(parts))
+	for _, part := range parts {
+		completed = append(completed, &s3.CompletedPart{
+			PartNumber: aws.Int64(int64(part.Number)),
+			ETag:       aws.String(part.ETag),
+		})
+	}
+
+	_, err := store.svc.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(store.Bucket),
+		Key:             aws.String(key),
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: completed},
+	})
+	if err != nil {
+		return s3Error("put", key, err)
+	}
+	return nil
+}
+
+func (store *S3ObjectStorage) abortUpload(ctx context.Context, key, uploadID string) error {
+	_, err := store.svc.AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(store.Bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	})
+	if err != nil {
+		return s3Error("abort", key, err)
+	}
+	return nil
+}
+
+// AbortStaleUploads 取消 prefix 下发起时间早于 olderThan 的未完成上传
+func (store *S3ObjectStorage) AbortStaleUploads(ctx context.Context, prefix string, olderThan time.Duration) (int, error) {
+	var (
+		deadline = time.Now().Add(-olderThan)
+		stale    []*s3.MultipartUpload
+	)
+
+	err := store.svc.ListMultipartUploadsPagesWithContext(ctx, &s3.ListMultipartUploadsInput{
 		Bucket: aws.String(store.Bucket),
-		Key:    aws.String(key),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListMultipartUploadsOutput, last bool) bool {
+		for _, upload := range page.Uploads {
+			if !aws.TimeValue(upload.Initiated).After(deadline) {
+				stale = append(stale, upload)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return 0, s3Error("abort", prefix, err)
+	}
+
+	for i, upload := range stale {
+		if err = store.abortUpload(ctx, aws.StringValue(upload.Key), aws.StringValue(upload.UploadId)); err != nil {
+			return i, err
+		}
 	}
+	return len(stale), nil
+}
 
-	_, err := store.svc.HeadObject(input)
+// SignedURL 生成预签名的 GET、HEAD 或 PUT 地址, PUT 时设置的 ContentType 会被签名,
+// 上传时必须使用相同的 Content-Type
+func (store *S3ObjectStorage) SignedURL(key, method string, expiry time.Duration, opts *SignOptions) (string, error) {
+	method, err := signMethod(key, method, expiry)
 	if err != nil {
-		return false
+		return "", err
+	}
+
+	if opts == nil {
+		opts = &SignOptions{}
 	}
 
-	return true
+	var req *request.Request
+	switch method {
+	case http.MethodGet:
+		req, _ = store.svc.GetObjectRequest(&s3.GetObjectInput{
+			Bucket:                     aws.String(store.Bucket),
+			Key:                        aws.String(key),
+			ResponseContentType:        s3String(opts.ContentType),
+			ResponseContentDisposition: s3String(opts.ContentDisposition),
+		})
+	case http.MethodHead:
+		req, _ = store.svc.HeadObjectRequest(&s3.HeadObjectInput{
+			Bucket: aws.String(store.Bucket),
+			Key:    aws.String(key),
+		})
+	default:
+		req, _ = store.svc.PutObjectRequest(&s3.PutObjectInput{
+			Bucket:      aws.String(store.Bucket),
+			Key:         aws.String(key),
+			ContentType: s3String(opts.ContentType),
+		})
+	}
+
+	u, err := req.Presign(expiry)
+	if err != nil {
+		return "", s3Error("sign", key, err)
+	}
+	return u, nil
+}
+
+// UploadPolicy 生成 SigV4 的 POST policy 表单直传策略
+func (store *S3ObjectStorage) UploadPolicy(keyPrefix string, maxSize int64, contentTypes []string, expiry time.Duration) (*PostPolicy, error) {
+	if err := checkPolicy(keyPrefix, maxSize, expiry); err != nil {
+		return nil, err
+	}
+
+	creds, err := store.svc.Config.Credentials.Get()
+	if err != nil {
+		return nil, s3Error("policy", keyPrefix, err)
+	}
+
+	u, err := url.Parse(store.svc.Endpoint)
+	if err != nil {
+		return nil, newError("policy", keyPrefix, ErrInvalid, err)
+	}
+
+	if aws.BoolValue(store.svc.Config.S3ForcePathStyle) {
+		u.Path = "/" + store.Bucket + "/"
+	} else {
+		u.Host = store.Bucket + "." + u.Host
+		u.Path = "/"
+	}
+
+	var expires = time.Now().Add(expiry)
+	fields, err := signS3PostPolicy(s3PostCredential{
+		AccessKey:    creds.AccessKeyID,
+		SecretKey:    creds.SecretAccessKey,
+		SessionToken: creds.SessionToken,
+		Region:       store.svc.SigningRegion,
+	}, store.Bucket, keyPrefix, maxSize, contentTypes, expires)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PostPolicy{URL: u.String(), Fields: fields, FileField: "file", Expires: expires}, nil
+}
+
+// s3String 空字符串返回 nil, 避免发送空的参数
+func s3String(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return aws.String(s)
 }
 
 func (store *S3ObjectStorage) WebURL(key string) (string, error) {
@@ -239,8 +824,56 @@ func (store *S3ObjectStorage) BucketName() string {
 }
 
 func (store *S3ObjectStorage) BucketURI(key string) BucketURI {
-	return BucketURI(fmt.Sprintf("%s://%s/%s", "qiniu", store.Bucket, key))
+	return BucketURI(fmt.Sprintf("%s://%s/%s", "s3", store.Bucket, key))
+}
 
+// s3Error 将 aws 的错误码映射为 storage 错误
+func s3Error(op, key string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	aerr, ok := err.(awserr.Error)
+	if !ok {
+		return newError(op, key, nil, err)
+	}
+
+	var kind error
+	switch aerr.Code() {
+	case s3.ErrCodeNoSuchKey, s3.ErrCodeNoSuchBucket, s3.ErrCodeNoSuchUpload, "NotFound", "NoSuchVersion":
+		kind = ErrNotExist
+	case s3.ErrCodeBucketAlreadyExists, s3.ErrCodeBucketAlreadyOwnedByYou:
+		kind = ErrExist
+	case "AccessDenied", "Forbidden", "AllAccessDisabled", "InvalidAccessKeyId", "SignatureDoesNotMatch":
+		kind = ErrPermission
+	case "InvalidArgument", "InvalidBucketName", "InvalidRange", "EntityTooLarge", "EntityTooSmall", "KeyTooLongError":
+		kind = ErrInvalid
+	case "NotImplemented":
+		kind = ErrNotImplemented
+	case "SlowDown", "Throttling", "ThrottlingException", "RequestLimitExceeded":
+		kind = ErrThrottled
+	case "InternalError", "ServiceUnavailable", "RequestTimeout", request.ErrCodeRequestError, request.ErrCodeResponseTimeout:
+		kind = ErrUnavailable
+	default:
+		// 部分错误 (例如 HeadObject 的 404) 只有状态码可用
+		if reqErr, ok := err.(awserr.RequestFailure); ok {
+			kind = kindOfStatus(reqErr.StatusCode())
+		}
+	}
+	return newError(op, key, kind, err)
 }
 
-var _ Storage = &S3ObjectStorage{}
+// keepsMetadata Stat 返回上传时的 Content-Encoding 与用户元数据
+func (store *S3ObjectStorage) keepsMetadata() {}
+
+var (
+	_ StorageContext    = &S3ObjectStorage{}
+	_ Lister            = &S3ObjectStorage{}
+	_ Signer            = &S3ObjectStorage{}
+	_ PolicySigner      = &S3ObjectStorage{}
+	_ MultipartUploader = &S3ObjectStorage{}
+	_ RangeReader       = &S3ObjectStorage{}
+	_ Copier            = &S3ObjectStorage{}
+	_ Batcher           = &S3ObjectStorage{}
+	_ Putter            = &S3ObjectStorage{}
+)
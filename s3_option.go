@@ -9,6 +9,22 @@ func S3Endpoint(url string) S3OptionFunc {
 	}
 }
 
+// S3Registry 注册到指定的注册表, 默认为 DefaultRegistry
+func S3Registry(registry *Registry) S3OptionFunc {
+	return func(s3 *S3ObjectStorage) error {
+		s3.registry = registry
+		return nil
+	}
+}
+
+// S3Encryption 默认的服务端加密, 可以通过 ContextWithEncryption 按次覆盖
+func S3Encryption(enc *Encryption) S3OptionFunc {
+	return func(s3 *S3ObjectStorage) error {
+		s3.Encryption = enc
+		return nil
+	}
+}
+
 func S3Region(region string) S3OptionFunc {
 	return func(s3 *S3ObjectStorage) error {
 		s3.Region = region
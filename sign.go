@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SignOptions 预签名地址的可选参数
+//
+// ContentType 在 PUT 时为上传必须使用的 Content-Type, 在 GET 时覆盖响应的 Content-Type;
+// ContentDisposition 覆盖 GET 响应的 Content-Disposition, 例如 attachment; filename="a.png"
+type SignOptions struct {
+	ContentType        string
+	ContentDisposition string
+}
+
+// Signer 支持生成预签名地址的存储, 浏览器可以直接使用地址上传或下载, 不需要经过服务端
+type Signer interface {
+	SignedURL(key, method string, expiry time.Duration, opts *SignOptions) (string, error)
+}
+
+// SignedURL 生成 store 的预签名地址, store 未实现 Signer 时返回 ErrNotImplemented
+func SignedURL(store Storage, key, method string, expiry time.Duration, opts *SignOptions) (string, error) {
+	signer, ok := store.(Signer)
+	if !ok {
+		return "", newError("sign", key, ErrNotImplemented, nil)
+	}
+	return signer.SignedURL(key, method, expiry, opts)
+}
+
+// signMethod 检查签名的方法与有效期, 返回大写的方法名
+func signMethod(key, method string, expiry time.Duration) (string, error) {
+	if expiry <= 0 {
+		return "", newError("sign", key, ErrInvalid, fmt.Errorf("invalid expiry %s", expiry))
+	}
+
+	method = strings.ToUpper(method)
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut:
+		return method, nil
+	default:
+		return "", newError("sign", key, ErrInvalid, fmt.Errorf("unsupported method %s", method))
+	}
+}
@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMinioStorage_SignedURL(t *testing.T) {
+	store, err := NewMinio("key", "secret", "sign-minio", MinioEndpoint("127.0.0.1:9000"), MinioRegion("us-east-1"), MinioRegistry(NewRegistry()))
+	assert.NoError(t, err)
+
+	raw, err := store.SignedURL("images/a.png", "get", time.Hour, &SignOptions{ContentDisposition: `attachment; filename="a.png"`})
+	assert.NoError(t, err)
+
+	u, err := url.Parse(raw)
+	assert.NoError(t, err)
+	assert.Equal(t, "/sign-minio/images/a.png", u.Path)
+	assert.Equal(t, "3600", u.Query().Get("X-Amz-Expires"))
+	assert.Equal(t, `attachment; filename="a.png"`, u.Query().Get("response-content-disposition"))
+
+	// 开头的 / 与 Get 一致
+	raw, err = store.SignedURL("/images/a.png", "get", time.Hour, nil)
+	assert.NoError(t, err)
+	u, err = url.Parse(raw)
+	assert.NoError(t, err)
+	assert.Equal(t, "/sign-minio/images/a.png", u.Path)
+
+	raw, err = store.SignedURL("images/a.png", "PUT", time.Minute, nil)
+	assert.NoError(t, err)
+	assert.Contains(t, raw, "X-Amz-Signature=")
+
+	_, err = store.SignedURL("images/a.png", "DELETE", time.Minute, nil)
+	assert.True(t, errors.Is(err, ErrInvalid))
+
+	_, err = store.SignedURL("images/a.png", "GET", 0, nil)
+	assert.True(t, errors.Is(err, ErrInvalid))
+}
+
+func TestS3ObjectStorage_SignedURL(t *testing.T) {
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Credentials: credentials.NewStaticCredentials("key", "secret", ""),
+	}))
+
+	store, err := NewS3("key", "secret", "sign-s3", sess, S3WebPrefix("http://s3.example.com"), S3Registry(NewRegistry()))
+	assert.NoError(t, err)
+
+	raw, err := store.SignedURL("images/a.png", "PUT", time.Hour, &SignOptions{ContentType: "image/png"})
+	assert.NoError(t, err)
+
+	u, err := url.Parse(raw)
+	assert.NoError(t, err)
+	assert.Equal(t, "3600", u.Query().Get("X-Amz-Expires"))
+	assert.Contains(t, u.Query().Get("X-Amz-SignedHeaders"), "content-type")
+
+	raw, err = store.SignedURL("images/a.png", "GET", time.Hour, &SignOptions{ContentType: "text/plain"})
+	assert.NoError(t, err)
+	assert.Contains(t, raw, "response-content-type=text%2Fplain")
+}
+
+func TestQiniuStorage_SignedURL(t *testing.T) {
+	store := NewQiniuStorage(&QiniuConfig{
+		AppKey:     "ak",
+		Secret:     "sk",
+		Bucket:     "sign-qiniu",
+		HttpPrefix: "cdn.example.com",
+		Private:    true,
+		Registry:   NewRegistry(),
+	})
+
+	raw, err := store.SignedURL("images/a.png", "GET", time.Hour, &SignOptions{ContentDisposition: `attachment; filename="b.png"`})
+	assert.NoError(t, err)
+
+	u, err := url.Parse(raw)
+	assert.NoError(t, err)
+	assert.Equal(t, "cdn.example.com", u.Host)
+	assert.NotEmpty(t, u.Query().Get("token"))
+	assert.Equal(t, "b.png", u.Query().Get("attname"))
+
+	_, err = store.SignedURL("images/a.png", "PUT", time.Hour, nil)
+	assert.True(t, errors.Is(err, ErrNotImplemented))
+	assert.NotEmpty(t, store.UploadToken("images/a.png", time.Hour))
+}
+
+func TestSignedURL_NotImplemented(t *testing.T) {
+	store, err := NewMemory("sign-mem", MemoryRegistry(NewRegistry()))
+	assert.NoError(t, err)
+
+	_, err = SignedURL(store, "a.png", "GET", time.Hour, nil)
+	assert.True(t, errors.Is(err, ErrNotImplemented))
+}
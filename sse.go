@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+)
+
+// EncryptionType 服务端加密方式
+type EncryptionType string
+
+const (
+	// SSES3 由服务端管理密钥
+	SSES3 EncryptionType = "SSE-S3"
+	// SSEKMS 使用 KMS 中的密钥
+	SSEKMS EncryptionType = "SSE-KMS"
+	// SSEC 使用客户提供的密钥, 读取、复制时需要提供同一个密钥
+	SSEC EncryptionType = "SSE-C"
+)
+
+// sseKeyLen SSE-C 的密钥长度, AES-256
+const sseKeyLen = 32
+
+// Encryption 服务端加密的配置, 可以通过存储的构造选项 (MinioEncryption、S3Encryption)、
+// ContextWithEncryption 或 PutOptions.Encryption 指定, 后者优先
+//
+// KeyID 为 SSE-KMS 的密钥 ID, 为空时使用默认密钥; Key 为 SSE-C 的 32 字节密钥
+type Encryption struct {
+	Type  EncryptionType
+	KeyID string
+	Key   []byte
+}
+
+// NewSSES3 由服务端管理密钥的加密
+func NewSSES3() *Encryption {
+	return &Encryption{Type: SSES3}
+}
+
+// NewSSEKMS 使用 KMS 密钥 keyID 加密
+func NewSSEKMS(keyID string) *Encryption {
+	return &Encryption{Type: SSEKMS, KeyID: keyID}
+}
+
+// NewSSEC 使用客户提供的 32 字节密钥加密
+func NewSSEC(key []byte) (*Encryption, error) {
+	var enc = &Encryption{Type: SSEC, Key: append([]byte(nil), key...)}
+	if err := enc.check(); err != nil {
+		return nil, newError("encrypt", "", ErrInvalid, err)
+	}
+	return enc, nil
+}
+
+func (enc *Encryption) check() error {
+	if enc == nil {
+		return nil
+	}
+
+	switch enc.Type {
+	case SSES3, SSEKMS:
+		return nil
+	case SSEC:
+		if len(enc.Key) != sseKeyLen {
+			return fmt.Errorf("SSE-C key must be %d bytes", sseKeyLen)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown encryption type %q", enc.Type)
+	}
+}
+
+// customerKey 只有 SSE-C 在读取对象与作为复制源时需要提供密钥, 其它方式返回 nil
+func (enc *Encryption) customerKey() *Encryption {
+	if enc == nil || enc.Type != SSEC {
+		return nil
+	}
+	return enc
+}
+
+type encryptionKey struct{}
+
+// ContextWithEncryption 为单次调用指定服务端加密, 覆盖存储的默认配置, enc 为 nil 时不加密
+func ContextWithEncryption(ctx context.Context, enc *Encryption) context.Context {
+	return context.WithValue(ctx, encryptionKey{}, enc)
+}
+
+// encryptionOf 依次使用 explicit、ctx 与存储的默认配置
+func encryptionOf(ctx context.Context, op, key string, explicit, def *Encryption) (*Encryption, error) {
+	var enc = def
+	if v, ok := ctx.Value(encryptionKey{}).(*Encryption); ok {
+		enc = v
+	}
+	if explicit != nil {
+		enc = explicit
+	}
+
+	if err := enc.check(); err != nil {
+		return nil, newError(op, key, ErrInvalid, err)
+	}
+	return enc, nil
+}
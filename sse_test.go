@@ -0,0 +1,196 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/stretchr/testify/assert"
+)
+
+// sseServer 记录每个请求的请求头, 按 S3 协议返回最简单的响应
+type sseServer struct {
+	mu       sync.Mutex
+	requests map[string]http.Header
+}
+
+func newSSEServer() *sseServer {
+	return &sseServer{requests: make(map[string]http.Header)}
+}
+
+func (srv *sseServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ioutil.ReadAll(r.Body)
+
+	var name = r.Method + " " + r.URL.Path
+	if r.Header.Get("X-Amz-Copy-Source") != "" {
+		name = "COPY " + r.URL.Path
+	}
+
+	srv.mu.Lock()
+	srv.requests[name] = r.Header.Clone()
+	srv.mu.Unlock()
+
+	w.Header().Set("ETag", `"d41d8cd98f00b204e9800998ecf8427e"`)
+	w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+
+	switch {
+	case name == "COPY "+r.URL.Path:
+		fmt.Fprint(w, `<CopyObjectResult><ETag>"d41d8cd98f00b204e9800998ecf8427e"</ETag><LastModified>2006-01-02T15:04:05.000Z</LastModified></CopyObjectResult>`)
+	case r.Method == http.MethodHead:
+		w.Header().Set("Content-Length", "5")
+	case r.Method == http.MethodGet:
+		w.Write([]byte("hello"))
+	}
+}
+
+func (srv *sseServer) header(name string) http.Header {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return srv.requests[name]
+}
+
+func sseKey() []byte {
+	return bytes.Repeat([]byte("k"), sseKeyLen)
+}
+
+func TestNewSSEC(t *testing.T) {
+	_, err := NewSSEC([]byte("short"))
+	assert.True(t, errors.Is(err, ErrInvalid))
+
+	enc, err := NewSSEC(sseKey())
+	assert.NoError(t, err)
+	assert.Equal(t, SSEC, enc.Type)
+}
+
+func TestEncryptionOf(t *testing.T) {
+	var (
+		def       = NewSSES3()
+		explicit  = NewSSEKMS("key")
+		ssec, _   = NewSSEC(sseKey())
+		ctx       = context.Background()
+		ctxWithC  = ContextWithEncryption(ctx, ssec)
+		ctxWithNo = ContextWithEncryption(ctx, nil)
+	)
+
+	enc, err := encryptionOf(ctx, "put", "a", nil, def)
+	assert.NoError(t, err)
+	assert.Equal(t, def, enc)
+
+	enc, _ = encryptionOf(ctxWithC, "put", "a", nil, def)
+	assert.Equal(t, ssec, enc)
+
+	enc, _ = encryptionOf(ctxWithC, "put", "a", explicit, def)
+	assert.Equal(t, explicit, enc)
+
+	// ContextWithEncryption(ctx, nil) 关闭默认加密
+	enc, _ = encryptionOf(ctxWithNo, "put", "a", nil, def)
+	assert.Nil(t, enc)
+
+	_, err = encryptionOf(ctx, "put", "a", &Encryption{Type: SSEC, Key: []byte("short")}, nil)
+	assert.True(t, errors.Is(err, ErrInvalid))
+}
+
+func TestS3ObjectStorage_Encryption(t *testing.T) {
+	fake := newSSEServer()
+	srv := httptest.NewTLSServer(fake)
+	defer srv.Close()
+
+	// SSE-C 只能通过 HTTPS 发送, 测试服务器的证书不在 AWS_CA_BUNDLE 中
+	t.Setenv("AWS_CA_BUNDLE", "")
+
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:           aws.String("us-east-1"),
+		Endpoint:         aws.String(srv.URL),
+		S3ForcePathStyle: aws.Bool(true),
+		Credentials:      credentials.NewStaticCredentials("key", "secret", ""),
+		HTTPClient:       srv.Client(),
+	}))
+	store, err := NewS3("key", "secret", "sse-s3", sess, S3Encryption(NewSSEKMS("kms-key")), S3Registry(NewRegistry()))
+	assert.NoError(t, err)
+
+	assert.NoError(t, store.Put("a.txt", []byte("hello")))
+	h := fake.header("PUT /sse-s3/a.txt")
+	assert.Equal(t, "aws:kms", h.Get("X-Amz-Server-Side-Encryption"))
+	assert.Equal(t, "kms-key", h.Get("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"))
+
+	// 读取 SSE-KMS 加密的对象不需要也不能带加密请求头
+	_, err = store.Get("a.txt")
+	assert.NoError(t, err)
+	assert.Empty(t, fake.header("GET /sse-s3/a.txt").Get("X-Amz-Server-Side-Encryption"))
+
+	ssec, err := NewSSEC(sseKey())
+	assert.NoError(t, err)
+	ctx := ContextWithEncryption(context.Background(), ssec)
+	sum := md5.Sum(sseKey())
+
+	assert.NoError(t, store.PutContext(ctx, "b.txt", []byte("hello")))
+	_, err = store.GetContext(ctx, "b.txt")
+	assert.NoError(t, err)
+	for _, name := range []string{"PUT /sse-s3/b.txt", "GET /sse-s3/b.txt"} {
+		h = fake.header(name)
+		assert.Equal(t, "AES256", h.Get("X-Amz-Server-Side-Encryption-Customer-Algorithm"), name)
+		assert.Equal(t, base64.StdEncoding.EncodeToString(sseKey()), h.Get("X-Amz-Server-Side-Encryption-Customer-Key"), name)
+		assert.Equal(t, base64.StdEncoding.EncodeToString(sum[:]), h.Get("X-Amz-Server-Side-Encryption-Customer-Key-Md5"), name)
+	}
+
+	// Move 使用同一个密钥解密源对象并加密目标对象
+	assert.NoError(t, store.MoveContext(ctx, "c.txt", "b.txt"))
+	h = fake.header("COPY /sse-s3/c.txt")
+	assert.Equal(t, "AES256", h.Get("X-Amz-Server-Side-Encryption-Customer-Algorithm"))
+	assert.Equal(t, base64.StdEncoding.EncodeToString(sseKey()), h.Get("X-Amz-Copy-Source-Server-Side-Encryption-Customer-Key"))
+	assert.Equal(t, base64.StdEncoding.EncodeToString(sseKey()), fake.header("HEAD /sse-s3/b.txt").Get("X-Amz-Server-Side-Encryption-Customer-Key"))
+
+	// 复制 SSE-C 对象为 SSE-KMS 对象
+	err = store.CopyContext(context.Background(), "d.txt", "c.txt", CopySourceEncryption(ssec))
+	assert.NoError(t, err)
+	h = fake.header("COPY /sse-s3/d.txt")
+	assert.Equal(t, "aws:kms", h.Get("X-Amz-Server-Side-Encryption"))
+	assert.Empty(t, h.Get("X-Amz-Server-Side-Encryption-Customer-Key"))
+	assert.Equal(t, base64.StdEncoding.EncodeToString(sseKey()), h.Get("X-Amz-Copy-Source-Server-Side-Encryption-Customer-Key"))
+}
+
+func TestMinioStorage_Encryption(t *testing.T) {
+	fake := newSSEServer()
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	store, err := NewMinio("key", "secret", "sse-minio",
+		MinioEndpoint(srv.Listener.Addr().String()),
+		MinioRegion("us-east-1"),
+		MinioEncryption(NewSSES3()),
+		MinioRegistry(NewRegistry()),
+	)
+	assert.NoError(t, err)
+
+	assert.NoError(t, store.Put("a.txt", []byte("hello")))
+	assert.Equal(t, "AES256", fake.header("PUT /sse-minio/a.txt").Get("X-Amz-Server-Side-Encryption"))
+
+	_, err = store.Stat("a.txt")
+	assert.NoError(t, err)
+	assert.Empty(t, fake.header("HEAD /sse-minio/a.txt").Get("X-Amz-Server-Side-Encryption"))
+
+	ssec, err := NewSSEC(sseKey())
+	assert.NoError(t, err)
+	ctx := ContextWithEncryption(context.Background(), ssec)
+
+	assert.NoError(t, store.CopyContext(ctx, "b.txt", "a.txt"))
+	h := fake.header("COPY /sse-minio/b.txt")
+	assert.Equal(t, "AES256", h.Get("X-Amz-Server-Side-Encryption-Customer-Algorithm"))
+	assert.Equal(t, base64.StdEncoding.EncodeToString(sseKey()), h.Get("X-Amz-Copy-Source-Server-Side-Encryption-Customer-Key"))
+
+	err = store.PutObjectContext(context.Background(), "c.txt", bytes.NewReader([]byte("hello")), 5, PutOptions{
+		Encryption: &Encryption{Type: SSEC, Key: []byte("short")},
+	})
+	assert.True(t, errors.Is(err, ErrInvalid))
+}
@@ -1,25 +1,127 @@
 package storage
 
 import (
+	"context"
+	"io"
 	"os"
 )
 
 // Storage 简易对象存储接口
+//
+// Open 与 PutReader 以流的方式读写对象, 不会把整个对象读入内存;
+// PutReader 的 size 为 -1 时表示长度未知; Exist 会忽略所有错误,
+// 需要区分对象不存在与其它错误时使用 Stat
 type Storage interface {
 	List(prefix string) ([]os.FileInfo, error)
 	Get(key string) ([]byte, error)
+	Open(key string) (io.ReadCloser, error)
 	PutFile(key string, file string) error
 	Put(key string, val []byte) error
+	PutReader(key string, r io.Reader, size int64) error
 	Move(dest string, from string) error
 	Remove(key string) error
 	Exist(key string) bool
+	Stat(key string) (os.FileInfo, error)
 	BucketName() string
 	WebURL(key string) (string, error)
 	BucketURI(key string) BucketURI
 }
 
-// FastdfsStorage fastdfs 对象存储
-type FastdfsStorage struct {
-	Endpoint string
-	Token    string
+// StorageContext 支持 context.Context 的对象存储接口, 方法的第一个参数为 ctx,
+// 用于取消请求与控制超时
+type StorageContext interface {
+	Storage
+	ListContext(ctx context.Context, prefix string) ([]os.FileInfo, error)
+	GetContext(ctx context.Context, key string) ([]byte, error)
+	OpenContext(ctx context.Context, key string) (io.ReadCloser, error)
+	PutFileContext(ctx context.Context, key string, file string) error
+	PutContext(ctx context.Context, key string, val []byte) error
+	PutReaderContext(ctx context.Context, key string, r io.Reader, size int64) error
+	MoveContext(ctx context.Context, dest string, from string) error
+	RemoveContext(ctx context.Context, key string) error
+	ExistContext(ctx context.Context, key string) bool
+	StatContext(ctx context.Context, key string) (os.FileInfo, error)
+}
+
+// AdaptContext 将 Storage 适配为 StorageContext, 如果 store 已经实现了
+// StorageContext 则直接返回; 否则只在调用前检查 ctx 是否已经结束
+func AdaptContext(store Storage) StorageContext {
+	if sc, ok := store.(StorageContext); ok {
+		return sc
+	}
+	return &contextAdapter{Storage: store}
+}
+
+type contextAdapter struct {
+	Storage
+}
+
+func (a *contextAdapter) ListContext(ctx context.Context, prefix string) ([]os.FileInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return a.List(prefix)
+}
+
+func (a *contextAdapter) GetContext(ctx context.Context, key string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return a.Get(key)
+}
+
+func (a *contextAdapter) OpenContext(ctx context.Context, key string) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return a.Open(key)
+}
+
+func (a *contextAdapter) PutFileContext(ctx context.Context, key string, file string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return a.PutFile(key, file)
+}
+
+func (a *contextAdapter) PutContext(ctx context.Context, key string, val []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return a.Put(key, val)
+}
+
+func (a *contextAdapter) PutReaderContext(ctx context.Context, key string, r io.Reader, size int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return a.PutReader(key, r, size)
+}
+
+func (a *contextAdapter) MoveContext(ctx context.Context, dest string, from string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return a.Move(dest, from)
+}
+
+func (a *contextAdapter) RemoveContext(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return a.Remove(key)
+}
+
+func (a *contextAdapter) ExistContext(ctx context.Context, key string) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	return a.Exist(key)
+}
+
+func (a *contextAdapter) StatContext(ctx context.Context, key string) (os.FileInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return a.Stat(key)
 }
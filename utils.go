@@ -1,13 +1,13 @@
 package storage
 
 import (
+	"database/sql/driver"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net"
-	"net/url"
 	"strconv"
 	"strings"
-	"sync"
 )
 
 type BucketURI string
@@ -24,33 +24,77 @@ func (uri BucketURI) UnknownURI() string {
 	return UnknownURI
 }
 
+// String 返回 DefaultRegistry 中对应存储的 http 地址
 func (uri BucketURI) String() string {
 	if Empty(string(uri)) {
 		return uri.UnknownURI()
 	}
+	return DefaultRegistry.URL(uri)
+}
+
+// Parse 解析出 scheme, bucket 与 key, key 不会以 / 开头
+//
+// key 按原样保存, 不做 url 解码, 与各存储 BucketURI 方法的拼接方式一致
+func (uri BucketURI) Parse() (scheme, bucket, key string, err error) {
+	var s = string(uri)
+
+	i := strings.Index(s, "://")
+	if i <= 0 {
+		return "", "", "", newError("parse", s, ErrInvalid, fmt.Errorf("missing scheme"))
+	}
 
-	u, err := url.Parse(string(uri))
+	scheme, s = s[:i], s[i+3:]
+	if j := strings.Index(s, "/"); j >= 0 {
+		bucket, key = s[:j], strings.TrimPrefix(s[j:], "/")
+	} else {
+		bucket = s
+	}
+
+	if bucket == "" {
+		return "", "", "", newError("parse", string(uri), ErrInvalid, fmt.Errorf("missing bucket"))
+	}
+	return scheme, bucket, key, nil
+}
+
+// Resolve 查找 DefaultRegistry 中的存储, 返回存储与对象的 key
+func (uri BucketURI) Resolve() (Storage, string, error) {
+	return DefaultRegistry.Resolve(uri)
+}
+
+// Open 打开 uri 对应的对象
+func (uri BucketURI) Open() (io.ReadCloser, error) {
+	store, key, err := uri.Resolve()
 	if err != nil {
-		return string(uri)
+		return nil, err
 	}
+	return store.Open(key)
+}
 
-	host, ok := GetBucketHost(u.Scheme, u.Host)
-	if !ok {
-		return string(uri)
+// Get 读取 uri 对应的对象内容
+func (uri BucketURI) Get() ([]byte, error) {
+	store, key, err := uri.Resolve()
+	if err != nil {
+		return nil, err
 	}
+	return store.Get(key)
+}
 
-	// if isPrivatehost(host) {
-	// 	if !config.GetBool("cloudmode.private") {
-	// 		utils.ExternalIP()
-	// 	}
-	// }
+// Exist 判断 uri 对应的对象是否存在, 存储未创建时返回 false
+func (uri BucketURI) Exist() bool {
+	store, key, err := uri.Resolve()
+	if err != nil {
+		return false
+	}
+	return store.Exist(key)
+}
 
-	switch u.Scheme {
-	case "minio", "s3", "qiniu":
-		return fmt.Sprintf("http://%s/%s%s", host, u.Host, u.Path)
-	default:
-		return string(uri)
+// Remove 删除 uri 对应的对象
+func (uri BucketURI) Remove() error {
+	store, key, err := uri.Resolve()
+	if err != nil {
+		return err
 	}
+	return store.Remove(key)
 }
 
 func isPrivatehost(host string) bool {
@@ -70,53 +114,49 @@ func (uri BucketURI) MarshalJSON() ([]byte, error) {
 	return json.Marshal(uri.String())
 }
 
-func Empty(s string) bool {
-	return len(strings.TrimSpace(s)) == 0
-}
-
-func QuoteBytes(u string) []byte {
-	return []byte(strconv.Quote(u))
-}
+// UnmarshalJSON 接受 minio://bucket/key 形式的 URI, 也接受 MarshalJSON 输出的 http 地址,
+// http 地址通过 DefaultRegistry 反查为 URI, 查不到时原样保存
+func (uri *BucketURI) UnmarshalJSON(b []byte) error {
+	var s *string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
 
-var stores sync.Map
+	if s == nil {
+		*uri = ""
+		return nil
+	}
 
-type storeHost struct {
-	Bucket string
-	Host   string
-	store  Storage
+	*uri = DefaultRegistry.ParseURL(*s)
+	return nil
 }
 
-func register(scheme string, store Storage, host string) {
-	var sts = []storeHost{{
-		Bucket: store.BucketName(),
-		Host:   host,
-		store:  store,
-	}}
+// Value 以 URI 形式保存到数据库, 而不是 http 地址
+func (uri BucketURI) Value() (driver.Value, error) {
+	return string(uri), nil
+}
 
-	if olds, load := stores.LoadOrStore(scheme, sts); load {
-		if stss, ok := olds.([]storeHost); ok {
-			stss = append(stss, sts...)
-			stores.Store(scheme, stss)
-		}
+// Scan 从数据库读取, 兼容之前保存为 http 地址的数据
+func (uri *BucketURI) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*uri = ""
+	case string:
+		*uri = DefaultRegistry.ParseURL(v)
+	case []byte:
+		*uri = DefaultRegistry.ParseURL(string(v))
+	default:
+		return fmt.Errorf("storage: cannot scan %T into BucketURI", src)
 	}
+	return nil
 }
 
-func GetBucketHost(scheme string, bucket string) (string, bool) {
-	sts, ok := stores.Load(scheme)
-	if !ok {
-		return "", false
-	}
-	if stss, ok := sts.([]storeHost); !ok {
-		return "", false
-	} else {
-		for _, st := range stss {
-			if st.Bucket == bucket {
-				return st.Host, true
-			}
-		}
-	}
+func Empty(s string) bool {
+	return len(strings.TrimSpace(s)) == 0
+}
 
-	return "", false
+func QuoteBytes(u string) []byte {
+	return []byte(strconv.Quote(u))
 }
 
 var (
@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBucketURI_Parse(t *testing.T) {
+	tests := []struct {
+		uri    BucketURI
+		scheme string
+		bucket string
+		key    string
+		err    error
+	}{
+		{uri: "minio://images/a/b.png", scheme: "minio", bucket: "images", key: "a/b.png"},
+		{uri: "s3://images//a.png", scheme: "s3", bucket: "images", key: "/a.png"},
+		{uri: "qiniu://images/100% a.png", scheme: "qiniu", bucket: "images", key: "100% a.png"},
+		{uri: "mem://images", scheme: "mem", bucket: "images"},
+		{uri: "images/a.png", err: ErrInvalid},
+		{uri: "mem:///a.png", err: ErrInvalid},
+	}
+
+	for _, tt := range tests {
+		scheme, bucket, key, err := tt.uri.Parse()
+		if tt.err != nil {
+			assert.True(t, errors.Is(err, tt.err), string(tt.uri))
+			continue
+		}
+
+		assert.NoError(t, err)
+		assert.Equal(t, tt.scheme, scheme)
+		assert.Equal(t, tt.bucket, bucket)
+		assert.Equal(t, tt.key, key)
+	}
+}
+
+func TestBucketURI_Resolve(t *testing.T) {
+	store, err := NewMemory("bucket-uri")
+	assert.NoError(t, err)
+	assert.NoError(t, store.Put("a/hello.txt", []byte("hello world")))
+
+	uri := store.BucketURI("a/hello.txt")
+
+	resolved, key, err := uri.Resolve()
+	assert.NoError(t, err)
+	assert.Equal(t, Storage(store), resolved)
+	assert.Equal(t, "a/hello.txt", key)
+
+	content, err := uri.Get()
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world", string(content))
+
+	rd, err := uri.Open()
+	assert.NoError(t, err)
+	content, err = ioutil.ReadAll(rd)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world", string(content))
+
+	assert.True(t, uri.Exist())
+	assert.NoError(t, uri.Remove())
+	assert.False(t, uri.Exist())
+
+	_, _, err = BucketURI("mem://missing-bucket/a.txt").Resolve()
+	assert.True(t, errors.Is(err, ErrUnknownBucket))
+	assert.False(t, BucketURI("mem://missing-bucket/a.txt").Exist())
+}
+
+func TestBucketURI_RoundTrip(t *testing.T) {
+	minio, err := NewMinio("key", "secret", "rt-minio", MinioEndpoint("127.0.0.1:9000"), MinioWebPrefix("http://minio.example.com"))
+	assert.NoError(t, err)
+
+	s3, err := NewS3("key", "secret", "rt-s3", session.New(&aws.Config{Region: aws.String("us-east-1")}), S3WebPrefix("http://s3.example.com"))
+	assert.NoError(t, err)
+
+	qiniu := NewQiniuStorage(&QiniuConfig{AppKey: "ak", Secret: "sk", Bucket: "rt-qiniu"})
+
+	local, err := NewLocal(t.TempDir(), LocalBucket("rt-file"), LocalWebPrefix("http://files.example.com"))
+	assert.NoError(t, err)
+
+	mem, err := NewMemory("rt-mem", MemoryWebPrefix("http://mem.example.com"))
+	assert.NoError(t, err)
+
+	fastdfs, err := NewFastdfs("http://127.0.0.1:8080", "", FastdfsGroup("rt-fastdfs"), FastdfsWithIndex(NewFastdfsMemoryIndex()), FastdfsWebPrefix("http://dfs.example.com/files"))
+	assert.NoError(t, err)
+	assert.NoError(t, fastdfs.Index.Store("images/a.png", FastdfsFile{ID: "/rt-fastdfs/default/abc"}))
+
+	for _, store := range []Storage{minio, s3, qiniu, local, mem, fastdfs} {
+		uri := store.BucketURI("images/a.png")
+
+		t.Run(string(uri), func(t *testing.T) {
+			// JSON 输出 http 地址, 读回时还原为 URI
+			b, err := json.Marshal(uri)
+			assert.NoError(t, err)
+			assert.NotEqual(t, `"`+string(uri)+`"`, string(b))
+
+			var got BucketURI
+			assert.NoError(t, json.Unmarshal(b, &got))
+			assert.Equal(t, uri, got)
+
+			assert.NoError(t, json.Unmarshal(QuoteBytes(string(uri)), &got))
+			assert.Equal(t, uri, got)
+
+			// 数据库中保存 URI
+			v, err := uri.Value()
+			assert.NoError(t, err)
+			assert.Equal(t, string(uri), v)
+
+			got = ""
+			assert.NoError(t, got.Scan([]byte(v.(string))))
+			assert.Equal(t, uri, got)
+		})
+	}
+}
+
+func TestBucketURI_Scan(t *testing.T) {
+	var uri BucketURI
+
+	assert.NoError(t, uri.Scan("http://unknown.example.com/a.png"))
+	assert.Equal(t, BucketURI("http://unknown.example.com/a.png"), uri)
+
+	assert.NoError(t, uri.Scan(nil))
+	assert.Equal(t, BucketURI(""), uri)
+
+	assert.Error(t, uri.Scan(1))
+
+	uri = "mem://bucket/a.png"
+	assert.NoError(t, json.Unmarshal([]byte("null"), &uri))
+	assert.Equal(t, BucketURI(""), uri)
+}